@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	VolatileDefaultAllowlistKey   = "volatile_default_allowlist"
+	DiagnosticCode                = "DEF-000"
+	DiagnosticCodeVolatileDefault = "DEF-001"
+	DiagnosticCodeSequenceDefault = "DEF-002"
+)
+
+type AddColumnVolatileDefaultAnalyzer struct{}
+
+func (a *AddColumnVolatileDefaultAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	allowlist := map[string]bool{}
+	if names, ok := analysis.GetConfigList(ctx, VolatileDefaultAllowlistKey); ok {
+		for _, name := range names {
+			allowlist[strings.ToLower(name)] = true
+		}
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// tables created within this same migration are empty, so rewriting them is harmless
+	createdTables := map[string]bool{}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		if create := statement.Stmt.GetCreateStmt(); create != nil {
+			createdTables[pgquery.GetRangeVarName(create.Relation)] = true
+		}
+		alter := statement.Stmt.GetAlterTableStmt()
+		if alter == nil || createdTables[pgquery.GetRangeVarName(alter.Relation)] {
+			continue
+		}
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+		table := alter.GetRelation().GetRelname()
+
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			if alterCmd == nil || alterCmd.Subtype != pg_query.AlterTableType_AT_AddColumn {
+				continue
+			}
+			colDef := alterCmd.GetDef().GetColumnDef()
+			if colDef == nil {
+				continue
+			}
+
+			// serial types implicitly add a volatile `DEFAULT nextval(...)`
+			typeName := strings.ToLower(pgquery.GetUnqualifiedName(colDef.GetTypeName().GetNames()))
+			if pgquery.SerialTypes[typeName] {
+				diagnostics = append(diagnostics, types.Diagnostic{
+					LineNumber:   textLocation.LineNumber,
+					LinePosition: textLocation.LineCharPosition,
+					Code:         DiagnosticCodeSequenceDefault,
+					Level:        types.DiagnosticLevelFatal,
+					Text:         fmt.Sprintf("ADD COLUMN %q of type %s to table %q fills every existing row from a sequence, forcing a table rewrite under an ACCESS EXCLUSIVE lock", colDef.Colname, typeName, table),
+				})
+			}
+
+			for _, node := range colDef.Constraints {
+				constraint := node.GetConstraint()
+				if constraint == nil {
+					continue
+				}
+				switch constraint.Contype {
+				case pg_query.ConstrType_CONSTR_IDENTITY:
+					diagnostics = append(diagnostics, types.Diagnostic{
+						LineNumber:   textLocation.LineNumber,
+						LinePosition: textLocation.LineCharPosition,
+						Code:         DiagnosticCodeSequenceDefault,
+						Level:        types.DiagnosticLevelFatal,
+						Text:         fmt.Sprintf("ADD COLUMN %q as an IDENTITY column to table %q fills every existing row from a sequence, forcing a table rewrite under an ACCESS EXCLUSIVE lock", colDef.Colname, table),
+					})
+				case pg_query.ConstrType_CONSTR_DEFAULT:
+					kind, function := pgquery.ClassifyDefault(constraint.RawExpr, allowlist)
+					if kind != pgquery.DefaultKindVolatile {
+						continue
+					}
+					text := fmt.Sprintf(
+						"ADD COLUMN %q to table %q has a DEFAULT calling volatile function %s(), forcing a table rewrite under an ACCESS EXCLUSIVE lock. Add the column without a default (or with a constant default), then backfill it",
+						colDef.Colname,
+						table,
+						function,
+					)
+					if !pgquery.VolatileFunctions[function] {
+						text += fmt.Sprintf(". If %s() is not volatile, add it to config key %q", function, VolatileDefaultAllowlistKey)
+					}
+					diagnostics = append(diagnostics, types.Diagnostic{
+						LineNumber:   textLocation.LineNumber,
+						LinePosition: textLocation.LineCharPosition,
+						Code:         DiagnosticCodeVolatileDefault,
+						Level:        types.DiagnosticLevelFatal,
+						Text:         text,
+					})
+				}
+			}
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any ALTER TABLE ... ADD COLUMN operation
+	// - does not have a volatile DEFAULT that forces a table rewrite
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&AddColumnVolatileDefaultAnalyzer{},
+		"Errors occurred around ALTER TABLE ... ADD COLUMN statement(s) with a volatile DEFAULT forcing a table rewrite",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"volatile default",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD COLUMN created_at timestamptz DEFAULT clock_timestamp();"}},
+			[]string{"1 DEF-001 FATAL 1:1"},
+		},
+		{
+			"volatile function nested within the default",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD COLUMN code text DEFAULT md5(random()::text);"}},
+			[]string{"1 DEF-001 FATAL 1:1"},
+		},
+		{
+			"stable default",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD COLUMN created_at timestamptz DEFAULT now();"}},
+			[]string{},
+		},
+		{
+			"constant default",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD COLUMN settings jsonb DEFAULT '{}'::jsonb;"}},
+			[]string{},
+		},
+		{
+			"allowlisted function",
+			map[string]string{VolatileDefaultAllowlistKey: "next_code"},
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD COLUMN code text DEFAULT next_code();"}},
+			[]string{},
+		},
+		{
+			"serial and identity columns",
+			nil,
+			[]analysistest.Migration{{Up: `ALTER TABLE users ADD COLUMN a bigserial;
+ALTER TABLE users ADD COLUMN b bigint GENERATED ALWAYS AS IDENTITY;`}},
+			[]string{"1 DEF-002 FATAL 1:1", "1 DEF-002 FATAL 2:1"},
+		},
+		{
+			"table created in the same migration",
+			nil,
+			[]analysistest.Migration{{Up: `CREATE TABLE users (id bigint);
+ALTER TABLE users ADD COLUMN token uuid DEFAULT gen_random_uuid();`}},
+			[]string{},
+		},
+		{
+			"down migration",
+			nil,
+			[]analysistest.Migration{{Up: "SELECT 1;", Down: "ALTER TABLE users ADD COLUMN token uuid DEFAULT gen_random_uuid();"}},
+			[]string{"1 DEF-001 FATAL 3:1"},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD;"}},
+			[]string{"1 DEF-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(test.config, test.migrations...), &AddColumnVolatileDefaultAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
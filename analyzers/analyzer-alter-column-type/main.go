@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DiagnosticCode            = "TYP-000"
+	DiagnosticCodeRewrite     = "TYP-001"
+	DiagnosticCodeNarrowing   = "TYP-002"
+	DiagnosticCodeUsing       = "TYP-003"
+	DiagnosticCodeTimeZone    = "TYP-004"
+	DiagnosticCodeUnknownType = "TYP-005"
+)
+
+// serial types are stored as their underlying integer type
+var TypeAliases = map[string]string{
+	"smallserial": "int2",
+	"serial2":     "int2",
+	"serial":      "int4",
+	"serial4":     "int4",
+	"bigserial":   "int8",
+	"serial8":     "int8",
+}
+
+// types whose single modifier (a max length or a precision) can be increased,
+// or removed entirely, without rewriting the table
+var LengthModifierTypes = map[string]bool{
+	"varchar":     true,
+	"varbit":      true,
+	"time":        true,
+	"timetz":      true,
+	"timestamp":   true,
+	"timestamptz": true,
+	"interval":    true,
+}
+
+// pairs of distinct types (from -> to) that are binary coercible,
+// provided the new type has no narrower modifier than the old type
+var BinaryCoercibleTypes = map[string]map[string]bool{
+	"varchar": {"text": true},
+	"text":    {"varchar": true},
+	"cidr":    {"inet": true},
+	"bit":     {"varbit": true},
+}
+
+type TypeChange struct {
+	Code  string
+	Level string
+	// explains what happens as a result of this type change
+	Reason string
+}
+
+func getCanonicalTypeName(typeName *pg_query.TypeName) string {
+	name := pgquery.GetTypeName(typeName)
+	if alias, ok := TypeAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+func rewrite() *TypeChange {
+	return &TypeChange{
+		Code:   DiagnosticCodeRewrite,
+		Level:  types.DiagnosticLevelFatal,
+		Reason: "is not binary coercible: the whole table is rewritten and all of its indexes are rebuilt under an ACCESS EXCLUSIVE lock",
+	}
+}
+
+func narrowing() *TypeChange {
+	return &TypeChange{
+		Code:   DiagnosticCodeNarrowing,
+		Level:  types.DiagnosticLevelFatal,
+		Reason: "narrows the column: every existing row is rewritten and checked against the new type under an ACCESS EXCLUSIVE lock, and the migration fails if any value does not fit",
+	}
+}
+
+// compares the modifiers of two types with the same name
+func classifyModifierChange(name string, from []int, to []int) *TypeChange {
+	if slices.Equal(from, to) {
+		return nil
+	}
+	if !LengthModifierTypes[name] && name != "numeric" {
+		return rewrite()
+	}
+	// removing the modifier entirely is always a widening, adding one is always a narrowing
+	if len(to) == 0 {
+		return nil
+	}
+	if len(from) == 0 {
+		return narrowing()
+	}
+	if name == "numeric" {
+		// numeric(p) is shorthand for numeric(p,0)
+		fromScale, toScale := 0, 0
+		if len(from) > 1 {
+			fromScale = from[1]
+		}
+		if len(to) > 1 {
+			toScale = to[1]
+		}
+		if fromScale != toScale {
+			return rewrite()
+		}
+	}
+	if to[0] < from[0] {
+		return narrowing()
+	}
+	return nil
+}
+
+// Classifies a column type change, returning nil if the change is binary coercible
+// ie, Postgres can make the change without rewriting the table or rebuilding its indexes
+func ClassifyTypeChange(from *pg_query.TypeName, to *pg_query.TypeName, hasUsing bool) *TypeChange {
+	if hasUsing {
+		return &TypeChange{
+			Code:   DiagnosticCodeUsing,
+			Level:  types.DiagnosticLevelFatal,
+			Reason: "has a USING clause: the expression is evaluated for every row, rewriting the whole table and rebuilding all of its indexes under an ACCESS EXCLUSIVE lock",
+		}
+	}
+	if from == nil {
+		return &TypeChange{
+			Code:   DiagnosticCodeUnknownType,
+			Level:  types.DiagnosticLevelWarning,
+			Reason: "could not be verified as binary coercible, as the previous type of the column is not known from earlier migrations. Unless it is, the whole table is rewritten and all of its indexes are rebuilt under an ACCESS EXCLUSIVE lock",
+		}
+	}
+	if pgquery.IsArrayType(from) != pgquery.IsArrayType(to) {
+		return rewrite()
+	}
+
+	fromName, toName := getCanonicalTypeName(from), getCanonicalTypeName(to)
+	fromModifiers, toModifiers := pgquery.GetTypeModifiers(from), pgquery.GetTypeModifiers(to)
+	if fromName == toName {
+		return classifyModifierChange(fromName, fromModifiers, toModifiers)
+	}
+
+	if (fromName == "timestamp" && toName == "timestamptz") || (fromName == "timestamptz" && toName == "timestamp") {
+		return &TypeChange{
+			Code:   DiagnosticCodeTimeZone,
+			Level:  types.DiagnosticLevelWarning,
+			Reason: "only avoids a table rewrite on Postgres 12+ when the session TimeZone is UTC, otherwise the whole table is rewritten. Indexes on the column are rebuilt either way, under an ACCESS EXCLUSIVE lock",
+		}
+	}
+
+	if BinaryCoercibleTypes[fromName][toName] {
+		if len(toModifiers) == 0 {
+			return nil
+		}
+		if len(fromModifiers) == 0 || toModifiers[0] < fromModifiers[0] {
+			return narrowing()
+		}
+		return nil
+	}
+	return rewrite()
+}
+
+type AlterColumnTypeAnalyzer struct {
+	// the type of every column, keyed by (possibly schema qualified) table name then column name,
+	// as created by all the up migrations analyzed so far
+	columnTypes map[string]map[string]*pg_query.TypeName
+}
+
+func (a *AlterColumnTypeAnalyzer) setColumnType(table string, column string, typeName *pg_query.TypeName) {
+	if a.columnTypes[table] == nil {
+		a.columnTypes[table] = map[string]*pg_query.TypeName{}
+	}
+	a.columnTypes[table][column] = typeName
+}
+
+// keep track of every column's type as the schema changes over each up migration
+func (a *AlterColumnTypeAnalyzer) applyStatement(statement *pg_query.RawStmt) {
+	if create := statement.Stmt.GetCreateStmt(); create != nil {
+		table := pgquery.GetRangeVarName(create.Relation)
+		a.columnTypes[table] = map[string]*pg_query.TypeName{}
+		for _, element := range create.TableElts {
+			if colDef := element.GetColumnDef(); colDef != nil {
+				a.setColumnType(table, colDef.Colname, colDef.TypeName)
+			}
+		}
+	}
+
+	if alter := statement.Stmt.GetAlterTableStmt(); alter != nil {
+		table := pgquery.GetRangeVarName(alter.Relation)
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			if alterCmd == nil {
+				continue
+			}
+			switch alterCmd.Subtype {
+			case pg_query.AlterTableType_AT_AddColumn:
+				if colDef := alterCmd.GetDef().GetColumnDef(); colDef != nil {
+					a.setColumnType(table, colDef.Colname, colDef.TypeName)
+				}
+			case pg_query.AlterTableType_AT_AlterColumnType:
+				if colDef := alterCmd.GetDef().GetColumnDef(); colDef != nil {
+					a.setColumnType(table, alterCmd.Name, colDef.TypeName)
+				}
+			case pg_query.AlterTableType_AT_DropColumn:
+				delete(a.columnTypes[table], alterCmd.Name)
+			}
+		}
+	}
+
+	if rename := statement.Stmt.GetRenameStmt(); rename != nil {
+		table := pgquery.GetRangeVarName(rename.Relation)
+		switch rename.RenameType {
+		case pg_query.ObjectType_OBJECT_TABLE:
+			// a table is renamed within its schema
+			renamed := pgquery.GetRangeVarName(&pg_query.RangeVar{Schemaname: rename.GetRelation().GetSchemaname(), Relname: rename.Newname})
+			a.columnTypes[renamed] = a.columnTypes[table]
+			delete(a.columnTypes, table)
+		case pg_query.ObjectType_OBJECT_COLUMN:
+			if typeName, ok := a.columnTypes[table][rename.Subname]; ok {
+				a.setColumnType(table, rename.Newname, typeName)
+				delete(a.columnTypes[table], rename.Subname)
+			}
+		}
+	}
+
+	if drop := statement.Stmt.GetDropStmt(); drop != nil && drop.RemoveType == pg_query.ObjectType_OBJECT_TABLE {
+		for _, object := range drop.Objects {
+			delete(a.columnTypes, pgquery.GetObjectName(object))
+		}
+	}
+}
+
+func (a *AlterColumnTypeAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// tables created within this same migration are empty, so rewriting them is harmless
+	createdTables := map[string]bool{}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		if create := statement.Stmt.GetCreateStmt(); create != nil {
+			createdTables[pgquery.GetRangeVarName(create.Relation)] = true
+		}
+
+		if alter := statement.Stmt.GetAlterTableStmt(); alter != nil && !createdTables[pgquery.GetRangeVarName(alter.Relation)] {
+			byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+			textLocation := pgquery.GetTextLocation(migration, byteOffset)
+			table := pgquery.GetRangeVarName(alter.Relation)
+
+			for _, cmd := range alter.Cmds {
+				alterCmd := cmd.GetAlterTableCmd()
+				if alterCmd == nil || alterCmd.Subtype != pg_query.AlterTableType_AT_AlterColumnType {
+					continue
+				}
+				colDef := alterCmd.GetDef().GetColumnDef()
+				if colDef == nil {
+					continue
+				}
+				// for ALTER COLUMN TYPE, the USING expression is parsed as the column's default
+				change := ClassifyTypeChange(a.columnTypes[table][alterCmd.Name], colDef.TypeName, colDef.RawDefault != nil)
+				if change == nil {
+					continue
+				}
+
+				from := "?"
+				if previous, ok := a.columnTypes[table][alterCmd.Name]; ok {
+					from = pgquery.FormatTypeName(previous)
+				}
+				diagnostics = append(diagnostics, types.Diagnostic{
+					LineNumber:   textLocation.LineNumber,
+					LinePosition: textLocation.LineCharPosition,
+					Code:         change.Code,
+					Level:        change.Level,
+					Text: fmt.Sprintf(
+						"ALTER COLUMN %q of table %q TYPE %s -> %s %s",
+						alterCmd.Name,
+						table,
+						from,
+						pgquery.FormatTypeName(colDef.TypeName),
+						change.Reason,
+					),
+				})
+			}
+		}
+
+		// only up migrations build up the schema, down migrations are expected to undo them
+		if analysis.GetDirection(ctx) == analysis.DirectionUp {
+			a.applyStatement(statement)
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any ALTER TABLE ... ALTER COLUMN ... TYPE operation
+	// - is binary coercible, so does not rewrite the table or rebuild its indexes
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&AlterColumnTypeAnalyzer{
+			columnTypes: map[string]map[string]*pg_query.TypeName{},
+		},
+		"Errors occurred around ALTER COLUMN ... TYPE statement(s) that rewrite the table or rebuild its indexes",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
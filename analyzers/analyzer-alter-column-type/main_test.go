@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// a migration creating table `users` in an earlier migration, so its column types are known
+const createUsers = `CREATE TABLE users (
+  id int4,
+  name varchar(50),
+  price numeric(10, 2),
+  seen_at timestamp,
+  tags text[],
+  address cidr
+);`
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"varchar to text is binary coercible",
+			[]analysistest.Migration{{Up: createUsers}, {Up: "ALTER TABLE users ALTER COLUMN name TYPE text;"}},
+			[]string{},
+		},
+		{
+			"widening a varchar is binary coercible",
+			[]analysistest.Migration{{Up: createUsers}, {Up: "ALTER TABLE users ALTER COLUMN name TYPE varchar(100);"}},
+			[]string{},
+		},
+		{
+			"cidr to inet is binary coercible",
+			[]analysistest.Migration{{Up: createUsers}, {Up: "ALTER TABLE users ALTER COLUMN address TYPE inet;"}},
+			[]string{},
+		},
+		{
+			"int to bigint rewrites the table",
+			[]analysistest.Migration{{Up: createUsers}, {Up: "ALTER TABLE users ALTER COLUMN id TYPE bigint;"}},
+			[]string{"2 TYP-001 FATAL 1:1"},
+		},
+		{
+			"serial is stored as int",
+			[]analysistest.Migration{{Up: "CREATE TABLE users (id serial);"}, {Up: "ALTER TABLE users ALTER COLUMN id TYPE int4;"}},
+			[]string{},
+		},
+		{
+			"changing the scale of a numeric rewrites the table",
+			[]analysistest.Migration{{Up: createUsers}, {Up: "ALTER TABLE users ALTER COLUMN price TYPE numeric(12, 3);"}},
+			[]string{"2 TYP-001 FATAL 1:1"},
+		},
+		{
+			"array to element type rewrites the table",
+			[]analysistest.Migration{{Up: createUsers}, {Up: "ALTER TABLE users ALTER COLUMN tags TYPE text;"}},
+			[]string{"2 TYP-001 FATAL 1:1"},
+		},
+		{
+			"narrowing a varchar",
+			[]analysistest.Migration{{Up: createUsers}, {Up: "ALTER TABLE users ALTER COLUMN name TYPE varchar(20);"}},
+			[]string{"2 TYP-002 FATAL 1:1"},
+		},
+		{
+			"using clause",
+			[]analysistest.Migration{{Up: createUsers}, {Up: "ALTER TABLE users ALTER COLUMN name TYPE text USING trim(name);"}},
+			[]string{"2 TYP-003 FATAL 1:1"},
+		},
+		{
+			"timestamp to timestamptz",
+			[]analysistest.Migration{{Up: createUsers}, {Up: "ALTER TABLE users ALTER COLUMN seen_at TYPE timestamptz;"}},
+			[]string{"2 TYP-004 WARNING 1:1"},
+		},
+		{
+			"column unknown from earlier migrations",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ALTER COLUMN name TYPE text;"}},
+			[]string{"1 TYP-005 WARNING 1:1"},
+		},
+		{
+			"tables in other schemas are distinct",
+			[]analysistest.Migration{{Up: createUsers}, {Up: "ALTER TABLE app.users ALTER COLUMN name TYPE text;"}},
+			[]string{"2 TYP-005 WARNING 1:1"},
+		},
+		{
+			"renamed column keeps its type",
+			[]analysistest.Migration{{Up: createUsers}, {Up: `ALTER TABLE users RENAME COLUMN id TO user_id;
+ALTER TABLE users ALTER COLUMN user_id TYPE bigint;`}},
+			[]string{"2 TYP-001 FATAL 2:1"},
+		},
+		{
+			"table created in the same migration",
+			[]analysistest.Migration{{Up: createUsers + "\nALTER TABLE users ALTER COLUMN id TYPE bigint;"}},
+			[]string{},
+		},
+		{
+			"down migrations do not change the known types",
+			[]analysistest.Migration{
+				{Up: createUsers, Down: "ALTER TABLE users ALTER COLUMN id TYPE bigint;"},
+				{Up: "ALTER TABLE users ALTER COLUMN id TYPE int8;"},
+			},
+			[]string{"1 TYP-001 FATAL 10:1", "2 TYP-001 FATAL 1:1"},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ALTER COLUMN TYPE;"}},
+			[]string{"1 TYP-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			analyzer := &AlterColumnTypeAnalyzer{
+				columnTypes: map[string]map[string]*pg_query.TypeName{},
+			}
+			output := analysis.DoSimpleAnalysis(analysistest.Input(nil, test.migrations...), analyzer, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DiagnosticCode                  = "CNV-000"
+	DiagnosticCodeForeignKey        = "CNV-001"
+	DiagnosticCodeCheck             = "CNV-002"
+	DiagnosticCodeColumnConstraint  = "CNV-003"
+	DiagnosticCodeValidateInSameTxn = "CNV-004"
+)
+
+const ValidateSeparatelySuggestionText = "Add the constraint with NOT VALID, then run ALTER TABLE ... VALIDATE CONSTRAINT in a later migration"
+
+// keyed by the constraint types in pgquery.ValidatedConstraintTypes
+type ConstraintInfo struct {
+	DiagnosticCode string
+	// the locks held while the constraint scans the whole table
+	LockText string
+}
+
+var ConstraintCodeToInfo = map[pg_query.ConstrType]ConstraintInfo{
+	pg_query.ConstrType_CONSTR_FOREIGN: ConstraintInfo{
+		DiagnosticCode: DiagnosticCodeForeignKey,
+		LockText:       "holding SHARE ROW EXCLUSIVE locks on both the table and the referenced table",
+	},
+	pg_query.ConstrType_CONSTR_CHECK: ConstraintInfo{
+		DiagnosticCode: DiagnosticCodeCheck,
+		LockText:       "holding an ACCESS EXCLUSIVE lock on the table",
+	},
+}
+
+func describeConstraint(constraint *pg_query.Constraint) string {
+	constraintType := pgquery.ValidatedConstraintTypes[constraint.Contype]
+	if constraint.Conname == "" {
+		return fmt.Sprintf("%s constraint", constraintType)
+	}
+	return fmt.Sprintf("%s constraint %q", constraintType, constraint.Conname)
+}
+
+type ConstraintNotValidAnalyzer struct{}
+
+func (a *ConstraintNotValidAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// tables created within this same migration are empty, so validating constraints on them is harmless
+	createdTables := map[string]bool{}
+	// constraints added with NOT VALID within this same migration, keyed by (possibly schema qualified) table name then constraint name
+	notValidConstraints := map[string]map[string]bool{}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		if create := statement.Stmt.GetCreateStmt(); create != nil {
+			createdTables[pgquery.GetRangeVarName(create.Relation)] = true
+		}
+		alter := statement.Stmt.GetAlterTableStmt()
+		if alter == nil || createdTables[pgquery.GetRangeVarName(alter.Relation)] {
+			continue
+		}
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+		table := pgquery.GetRangeVarName(alter.Relation)
+
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			if alterCmd == nil {
+				continue
+			}
+			switch alterCmd.Subtype {
+			case pg_query.AlterTableType_AT_AddConstraint:
+				if constraint := alterCmd.GetDef().GetConstraint(); constraint.GetSkipValidation() {
+					if notValidConstraints[table] == nil {
+						notValidConstraints[table] = map[string]bool{}
+					}
+					notValidConstraints[table][constraint.Conname] = true
+				}
+				for _, constraint := range pgquery.GetValidatedConstraints(alterCmd) {
+					info := ConstraintCodeToInfo[constraint.Contype]
+					diagnostics = append(diagnostics, types.Diagnostic{
+						LineNumber:   textLocation.LineNumber,
+						LinePosition: textLocation.LineCharPosition,
+						Code:         info.DiagnosticCode,
+						Level:        types.DiagnosticLevelWarning,
+						Text: fmt.Sprintf(
+							"ADD %s to table %q without NOT VALID scans the whole table while %s. %s",
+							describeConstraint(constraint),
+							table,
+							info.LockText,
+							ValidateSeparatelySuggestionText,
+						),
+					})
+				}
+
+			case pg_query.AlterTableType_AT_AddColumn:
+				// constraints declared inline on a new column can not be marked NOT VALID
+				colDef := alterCmd.GetDef().GetColumnDef()
+				for _, constraint := range pgquery.GetValidatedConstraints(alterCmd) {
+					info := ConstraintCodeToInfo[constraint.Contype]
+					diagnostics = append(diagnostics, types.Diagnostic{
+						LineNumber:   textLocation.LineNumber,
+						LinePosition: textLocation.LineCharPosition,
+						Code:         DiagnosticCodeColumnConstraint,
+						Level:        types.DiagnosticLevelWarning,
+						Text: fmt.Sprintf(
+							"ADD COLUMN %q to table %q with an inline %s constraint scans the whole table while %s. Add the column without the constraint, then add the constraint separately with NOT VALID and VALIDATE it in a later migration",
+							colDef.Colname,
+							table,
+							pgquery.ValidatedConstraintTypes[constraint.Contype],
+							info.LockText,
+						),
+					})
+				}
+
+			case pg_query.AlterTableType_AT_ValidateConstraint:
+				// when the migration is not run in a transaction, the NOT VALID constraint
+				// is committed (and its lock released) before the validation starts
+				if options["transaction"] == "false" || !notValidConstraints[table][alterCmd.Name] {
+					continue
+				}
+				diagnostics = append(diagnostics, types.Diagnostic{
+					LineNumber:   textLocation.LineNumber,
+					LinePosition: textLocation.LineCharPosition,
+					Code:         DiagnosticCodeValidateInSameTxn,
+					Level:        types.DiagnosticLevelWarning,
+					Text: fmt.Sprintf(
+						"VALIDATE CONSTRAINT %q on table %q happens in the same transaction that added it with NOT VALID, so the locks taken when adding it are held for the whole validation. Run VALIDATE CONSTRAINT in a later migration",
+						alterCmd.Name,
+						table,
+					),
+				})
+			}
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any FOREIGN KEY or CHECK constraint added to an existing table
+	// - is added with NOT VALID, and validated in a separate transaction
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&ConstraintNotValidAnalyzer{},
+		"Errors occurred around FOREIGN KEY or CHECK constraint(s) added without NOT VALID",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"foreign key without NOT VALID",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD CONSTRAINT users_org_fk FOREIGN KEY (org_id) REFERENCES orgs (id);"}},
+			[]string{"1 CNV-001 WARNING 1:1"},
+		},
+		{
+			"check without NOT VALID",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD CONSTRAINT users_age_check CHECK (age > 0);"}},
+			[]string{"1 CNV-002 WARNING 1:1"},
+		},
+		{
+			"NOT VALID",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD CONSTRAINT users_age_check CHECK (age > 0) NOT VALID;"}},
+			[]string{},
+		},
+		{
+			"unique constraints are not validated",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);"}},
+			[]string{},
+		},
+		{
+			"inline constraint on a new column",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD COLUMN org_id bigint REFERENCES orgs (id);"}},
+			[]string{"1 CNV-003 WARNING 1:1"},
+		},
+		{
+			"NOT VALID followed by VALIDATE in the same transaction",
+			[]analysistest.Migration{{Up: `ALTER TABLE users ADD CONSTRAINT users_org_fk FOREIGN KEY (org_id) REFERENCES orgs (id) NOT VALID;
+ALTER TABLE users VALIDATE CONSTRAINT users_org_fk;`}},
+			[]string{"1 CNV-004 WARNING 2:1"},
+		},
+		{
+			"NOT VALID followed by VALIDATE outside of a transaction",
+			[]analysistest.Migration{{Up: `ALTER TABLE users ADD CONSTRAINT users_org_fk FOREIGN KEY (org_id) REFERENCES orgs (id) NOT VALID;
+ALTER TABLE users VALIDATE CONSTRAINT users_org_fk;`, NoTransaction: true}},
+			[]string{},
+		},
+		{
+			"NOT VALID followed by VALIDATE in a later migration",
+			[]analysistest.Migration{
+				{Up: "ALTER TABLE users ADD CONSTRAINT users_org_fk FOREIGN KEY (org_id) REFERENCES orgs (id) NOT VALID;"},
+				{Up: "ALTER TABLE users VALIDATE CONSTRAINT users_org_fk;"},
+			},
+			[]string{},
+		},
+		{
+			"VALIDATE of a same named constraint on a table in another schema",
+			[]analysistest.Migration{{Up: `ALTER TABLE users ADD CONSTRAINT users_org_fk FOREIGN KEY (org_id) REFERENCES orgs (id) NOT VALID;
+ALTER TABLE app.users VALIDATE CONSTRAINT users_org_fk;`}},
+			[]string{},
+		},
+		{
+			"table created in the same migration",
+			[]analysistest.Migration{{Up: `CREATE TABLE users (id bigint, org_id bigint);
+ALTER TABLE users ADD CONSTRAINT users_org_fk FOREIGN KEY (org_id) REFERENCES orgs (id);`}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD CONSTRAINT;"}},
+			[]string{"1 CNV-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(nil, test.migrations...), &ConstraintNotValidAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
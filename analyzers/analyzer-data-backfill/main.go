@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DiagnosticCode                  = "BKF-000"
+	DiagnosticCodeUpdateAll         = "BKF-001"
+	DiagnosticCodeDeleteAll         = "BKF-002"
+	DiagnosticCodeMixedDDLAndDML    = "BKF-003"
+	BatchingSuggestionText          = "Backfill in small batches (eg: by primary key ranges) outside of the schema migration"
+	SeparateMigrationSuggestionText = "Move the data change into its own migration, or run the migration with `transaction:false`"
+)
+
+// Reports whether a statement changes the schema, ie: is anything other than
+// a query, a data change, or a session/transaction control statement
+func IsDDL(statement *pg_query.RawStmt) bool {
+	switch statement.Stmt.GetNode().(type) {
+	case *pg_query.Node_SelectStmt,
+		*pg_query.Node_InsertStmt,
+		*pg_query.Node_UpdateStmt,
+		*pg_query.Node_DeleteStmt,
+		*pg_query.Node_MergeStmt,
+		*pg_query.Node_CopyStmt,
+		*pg_query.Node_VariableSetStmt,
+		*pg_query.Node_VariableShowStmt,
+		*pg_query.Node_TransactionStmt,
+		*pg_query.Node_NotifyStmt,
+		*pg_query.Node_DoStmt:
+		return false
+	}
+	return true
+}
+
+type DataChange struct {
+	Statement   string
+	Table       string
+	WhereClause *pg_query.Node
+}
+
+// Returns the UPDATE or DELETE a statement performs, or nil if it is neither
+func GetDataChange(statement *pg_query.RawStmt) *DataChange {
+	if update := statement.Stmt.GetUpdateStmt(); update != nil {
+		return &DataChange{
+			Statement:   "UPDATE",
+			Table:       pgquery.GetRangeVarName(update.Relation),
+			WhereClause: update.WhereClause,
+		}
+	}
+	if remove := statement.Stmt.GetDeleteStmt(); remove != nil {
+		return &DataChange{
+			Statement:   "DELETE",
+			Table:       pgquery.GetRangeVarName(remove.Relation),
+			WhereClause: remove.WhereClause,
+		}
+	}
+	return nil
+}
+
+type DataBackfillAnalyzer struct{}
+
+func (a *DataBackfillAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// dbmate runs every migration in a transaction unless `transaction:false` is set
+	// in which case row locks are released as soon as each statement finishes
+	inTransaction := options["transaction"] != "false"
+
+	hasDDL := false
+	// tables created within this same migration are empty, so changing their data is harmless
+	createdTables := map[string]bool{}
+	for _, statement := range parseTree.Stmts {
+		if IsDDL(statement) {
+			hasDDL = true
+		}
+		if create := statement.Stmt.GetCreateStmt(); create != nil {
+			createdTables[pgquery.GetRangeVarName(create.Relation)] = true
+		}
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		change := GetDataChange(statement)
+		if change == nil || createdTables[change.Table] {
+			continue
+		}
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		if change.WhereClause == nil {
+			code := DiagnosticCodeUpdateAll
+			if change.Statement == "DELETE" {
+				code = DiagnosticCodeDeleteAll
+			}
+			level := types.DiagnosticLevelFatal
+			lockText := "locking every row until the migration's transaction commits"
+			if !inTransaction {
+				level = types.DiagnosticLevelWarning
+				lockText = "locking every row until the statement finishes"
+			}
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        level,
+				Text:         fmt.Sprintf("%s of table %q without a WHERE clause touches the whole table, %s. %s", change.Statement, change.Table, lockText, BatchingSuggestionText),
+			})
+			continue
+		}
+
+		if hasDDL && inTransaction {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         DiagnosticCodeMixedDDLAndDML,
+				Level:        types.DiagnosticLevelWarning,
+				Text:         fmt.Sprintf("%s of table %q runs in the same transaction as DDL statements, so any locks the DDL takes are held for as long as the %s runs. %s", change.Statement, change.Table, change.Statement, SeparateMigrationSuggestionText),
+			})
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any UPDATE or DELETE operation has a WHERE clause
+	// - and does not run in the same transaction as DDL statements
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&DataBackfillAnalyzer{},
+		"Errors occurred around UPDATE or DELETE statement(s) backfilling data inside a schema migration",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
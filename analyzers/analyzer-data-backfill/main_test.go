@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"UPDATE and DELETE without a WHERE clause",
+			[]analysistest.Migration{{Up: "UPDATE users SET a = 1;\nDELETE FROM orgs;"}},
+			[]string{"1 BKF-001 FATAL 1:1", "1 BKF-002 FATAL 2:1"},
+		},
+		{
+			"without a WHERE clause outside of a transaction",
+			[]analysistest.Migration{{Up: "UPDATE users SET a = 1;", NoTransaction: true}},
+			[]string{"1 BKF-001 WARNING 1:1"},
+		},
+		{
+			"with a WHERE clause",
+			[]analysistest.Migration{{Up: "UPDATE users SET a = 1 WHERE id < 1000;\nDELETE FROM orgs WHERE id = 1;"}},
+			[]string{},
+		},
+		{
+			"data change in the same transaction as DDL",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD COLUMN a int;\nUPDATE users SET a = 1 WHERE id < 1000;"}},
+			[]string{"1 BKF-003 WARNING 2:1"},
+		},
+		{
+			"data change and DDL outside of a transaction",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD COLUMN a int;\nUPDATE users SET a = 1 WHERE id < 1000;", NoTransaction: true}},
+			[]string{},
+		},
+		{
+			"session settings are not DDL",
+			[]analysistest.Migration{{Up: "SET lock_timeout = '5s';\nUPDATE users SET a = 1 WHERE id < 1000;"}},
+			[]string{},
+		},
+		{
+			"table created in the same migration",
+			[]analysistest.Migration{{Up: "CREATE TABLE app.users (a int);\nUPDATE app.users SET a = 1;\nUPDATE users SET a = 1;"}},
+			[]string{"1 BKF-001 FATAL 3:1"},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "UPDATE users SET;"}},
+			[]string{"1 BKF-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(nil, test.migrations...), &DataBackfillAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
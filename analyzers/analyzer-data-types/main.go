@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	BanTimestampKey         = "ban_timestamp"
+	BanVarcharKey           = "ban_varchar"
+	BanCharKey              = "ban_char"
+	BanMoneyKey             = "ban_money"
+	BanSerialKey            = "ban_serial"
+	BannedTypesKey          = "banned_types"
+	DiagnosticCode          = "DTY-000"
+	DiagnosticCodeTimestamp = "DTY-001"
+	DiagnosticCodeVarchar   = "DTY-002"
+	DiagnosticCodeChar      = "DTY-003"
+	DiagnosticCodeMoney     = "DTY-004"
+	DiagnosticCodeSerial    = "DTY-005"
+	DiagnosticCodeCustom    = "DTY-006"
+)
+
+type BannedType struct {
+	// the boolean config key that switches this ban off when set to false
+	ConfigKey      string
+	DiagnosticCode string
+	Preferred      string
+	Reason         string
+	Matches        func(typeName *pg_query.TypeName) bool
+}
+
+func matchesName(names ...string) func(typeName *pg_query.TypeName) bool {
+	return func(typeName *pg_query.TypeName) bool {
+		for _, name := range names {
+			if pgquery.GetTypeName(typeName) == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+var BannedTypes = []BannedType{
+	BannedType{
+		ConfigKey:      BanTimestampKey,
+		DiagnosticCode: DiagnosticCodeTimestamp,
+		Preferred:      "timestamptz",
+		Reason:         "it stores no time zone, so values silently shift whenever a client's time zone differs from the writer's",
+		Matches:        matchesName("timestamp"),
+	},
+	BannedType{
+		ConfigKey:      BanVarcharKey,
+		DiagnosticCode: DiagnosticCodeVarchar,
+		Preferred:      "text (with a CHECK constraint on its length if needed)",
+		Reason:         "it performs no better than text, and changing its length later requires an ALTER COLUMN TYPE",
+		Matches: func(typeName *pg_query.TypeName) bool {
+			return pgquery.GetTypeName(typeName) == "varchar" && len(pgquery.GetTypeModifiers(typeName)) > 0
+		},
+	},
+	BannedType{
+		ConfigKey:      BanCharKey,
+		DiagnosticCode: DiagnosticCodeChar,
+		Preferred:      "text",
+		Reason:         "it pads values with spaces, which are then ignored in some comparisons but not others",
+		Matches:        matchesName("bpchar"),
+	},
+	BannedType{
+		ConfigKey:      BanMoneyKey,
+		DiagnosticCode: DiagnosticCodeMoney,
+		Preferred:      "numeric",
+		Reason:         "its precision and formatting depend on the database's lc_monetary setting",
+		Matches:        matchesName("money"),
+	},
+	BannedType{
+		ConfigKey:      BanSerialKey,
+		DiagnosticCode: DiagnosticCodeSerial,
+		Preferred:      "bigint GENERATED ALWAYS AS IDENTITY",
+		Reason:         "its sequence is a separate object with its own permissions, and is easily left behind or out of sync",
+		Matches:        matchesName("smallserial", "serial2", "serial", "serial4", "bigserial", "serial8"),
+	},
+}
+
+// Parses team-specific banned:preferred type pairs, eg: `json:jsonb,double precision:numeric`
+func ParseBannedTypes(values []string) ([]BannedType, error) {
+	bannedTypes := []BannedType{}
+	for _, value := range values {
+		banned, preferred, ok := strings.Cut(value, ":")
+		banned, preferred = strings.TrimSpace(banned), strings.TrimSpace(preferred)
+		if !ok || banned == "" || preferred == "" {
+			return nil, fmt.Errorf("error parsing config key %q value %q: expected a `banned:preferred` type pair", BannedTypesKey, value)
+		}
+		// compare the type's internal name, as read from columns, eg: `int4` for `integer`
+		typeName, err := pgquery.ParseTypeName(banned)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing config key %q value %q: %w", BannedTypesKey, value, err)
+		}
+		bannedTypes = append(bannedTypes, BannedType{
+			DiagnosticCode: DiagnosticCodeCustom,
+			Preferred:      preferred,
+			Reason:         fmt.Sprintf("it is banned by config key %q", BannedTypesKey),
+			Matches:        matchesName(pgquery.GetTypeName(typeName)),
+		})
+	}
+	return bannedTypes, nil
+}
+
+// Returns a type as written in a migration, rather than its internal name
+// eg: `char(3)` rather than `bpchar(3)`
+func formatType(typeName *pg_query.TypeName) string {
+	text := pgquery.FormatTypeName(typeName)
+	if pgquery.GetTypeName(typeName) == "bpchar" {
+		return "char" + strings.TrimPrefix(text, "bpchar")
+	}
+	return text
+}
+
+type TypedColumn struct {
+	Table    string
+	Column   string
+	TypeName *pg_query.TypeName
+}
+
+// Returns every column a statement creates or changes the type of
+func GetTypedColumns(statement *pg_query.RawStmt) []TypedColumn {
+	columns := []TypedColumn{}
+	if create := statement.Stmt.GetCreateStmt(); create != nil {
+		table := pgquery.GetRangeVarName(create.Relation)
+		for _, element := range create.TableElts {
+			if colDef := element.GetColumnDef(); colDef != nil {
+				columns = append(columns, TypedColumn{Table: table, Column: colDef.Colname, TypeName: colDef.TypeName})
+			}
+		}
+	}
+
+	if alter := statement.Stmt.GetAlterTableStmt(); alter != nil {
+		table := pgquery.GetRangeVarName(alter.Relation)
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			colDef := alterCmd.GetDef().GetColumnDef()
+			switch alterCmd.GetSubtype() {
+			case pg_query.AlterTableType_AT_AddColumn:
+				columns = append(columns, TypedColumn{Table: table, Column: colDef.GetColname(), TypeName: colDef.GetTypeName()})
+			case pg_query.AlterTableType_AT_AlterColumnType:
+				columns = append(columns, TypedColumn{Table: table, Column: alterCmd.Name, TypeName: colDef.GetTypeName()})
+			}
+		}
+	}
+	return columns
+}
+
+type DataTypesAnalyzer struct{}
+
+func (a *DataTypesAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	// a down migration restores columns to the types they had before the up migration
+	if analysis.GetDirection(ctx) != analysis.DirectionUp {
+		return nil
+	}
+
+	configError := func(err error) []types.Diagnostic {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         err.Error(),
+		}}
+	}
+
+	// every built in ban is enabled unless switched off
+	bannedTypes := []BannedType{}
+	for _, bannedType := range BannedTypes {
+		enabled, err := analysis.GetConfigBool(ctx, bannedType.ConfigKey, true)
+		if err != nil {
+			return configError(err)
+		}
+		if enabled {
+			bannedTypes = append(bannedTypes, bannedType)
+		}
+	}
+	if values, ok := analysis.GetConfigList(ctx, BannedTypesKey); ok {
+		customTypes, err := ParseBannedTypes(values)
+		if err != nil {
+			return configError(err)
+		}
+		bannedTypes = append(bannedTypes, customTypes...)
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		for _, column := range GetTypedColumns(statement) {
+			for _, bannedType := range bannedTypes {
+				if !bannedType.Matches(column.TypeName) {
+					continue
+				}
+				diagnostics = append(diagnostics, types.Diagnostic{
+					LineNumber:   textLocation.LineNumber,
+					LinePosition: textLocation.LineCharPosition,
+					Code:         bannedType.DiagnosticCode,
+					Level:        types.DiagnosticLevelWarning,
+					Text: fmt.Sprintf(
+						"Column %q of table %q uses type %s: %s. Use %s instead",
+						column.Column,
+						column.Table,
+						formatType(column.TypeName),
+						bannedType.Reason,
+						bannedType.Preferred,
+					),
+				})
+				break
+			}
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any column created, added or altered
+	// - does not use a banned data type (eg: timestamp, varchar(n), char(n), money, serial)
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&DataTypesAnalyzer{},
+		"Errors occurred around column(s) using a banned data type",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
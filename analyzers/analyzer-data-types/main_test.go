@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"every built in banned type",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE a (b timestamp, c varchar(10), d char(3), e money, f serial);"}},
+			[]string{"1 DTY-001 WARNING 1:1", "1 DTY-002 WARNING 1:1", "1 DTY-003 WARNING 1:1", "1 DTY-004 WARNING 1:1", "1 DTY-005 WARNING 1:1"},
+		},
+		{
+			"preferred types",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE a (b timestamptz, c varchar, d text, e numeric, f bigint GENERATED ALWAYS AS IDENTITY);"}},
+			[]string{},
+		},
+		{
+			"column added or changed to a banned type",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE a ADD COLUMN b timestamp;\nALTER TABLE a ALTER COLUMN c TYPE bigserial;"}},
+			[]string{"1 DTY-001 WARNING 1:1", "1 DTY-005 WARNING 2:1"},
+		},
+		{
+			"banned type restored by a down migration",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE a ALTER COLUMN b TYPE timestamptz;", Down: "ALTER TABLE a ALTER COLUMN b TYPE timestamp;"}},
+			[]string{},
+		},
+		{
+			"built in ban switched off",
+			map[string]string{BanTimestampKey: "false"},
+			[]analysistest.Migration{{Up: "CREATE TABLE a (b timestamp, c money);"}},
+			[]string{"1 DTY-004 WARNING 1:1"},
+		},
+		{
+			"custom banned types",
+			map[string]string{BannedTypesKey: "json:jsonb,integer:bigint"},
+			[]analysistest.Migration{{Up: "CREATE TABLE a (b json, c int4, d jsonb);"}},
+			[]string{"1 DTY-006 WARNING 1:1", "1 DTY-006 WARNING 1:1"},
+		},
+		{
+			"malformed config",
+			map[string]string{BannedTypesKey: "json"},
+			[]analysistest.Migration{{Up: "CREATE TABLE a (b json);"}},
+			[]string{"1 DTY-000 FATAL -1:-1"},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE a (b);"}},
+			[]string{"1 DTY-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(test.config, test.migrations...), &DataTypesAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/catalog"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DiagnosticCode            = "INV-000"
+	DiagnosticCodeLeftBehind  = "INV-001"
+	DiagnosticCodeNotRestored = "INV-002"
+	DiagnosticCodeChanged     = "INV-003"
+)
+
+type DownMigrationInverseAnalyzer struct {
+	// the schema built up by all the up migrations analyzed so far
+	schema *catalog.Catalog
+	// the schema as it was before the most recently analyzed up migration, or nil if it failed to parse
+	before *catalog.Catalog
+	// where the most recently analyzed up migration first changes each object, keyed by catalog.Difference.Key
+	changes map[string]pgquery.TextLocation
+}
+
+func (a *DownMigrationInverseAnalyzer) applyUp(migration string, parseTree *pg_query.ParseResult) {
+	a.before = a.schema.Clone()
+	a.changes = map[string]pgquery.TextLocation{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		previous := a.schema.Clone()
+		a.schema.Apply(statement)
+
+		// a table only referenced by the up migration already existed before it
+		for name, table := range a.schema.Tables {
+			if _, ok := previous.Tables[name]; !ok && table.Partial {
+				previous.Tables[name] = &catalog.Table{Name: name, Constraints: map[string]string{}, Partial: true}
+				a.before.Tables[name] = previous.Tables[name]
+			}
+		}
+
+		for _, difference := range catalog.Diff(previous, a.schema) {
+			if _, ok := a.changes[difference.Key]; !ok {
+				a.changes[difference.Key] = textLocation
+			}
+		}
+	}
+}
+
+func (a *DownMigrationInverseAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		if analysis.GetDirection(ctx) == analysis.DirectionUp {
+			a.before = nil
+		}
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// every up migration is analyzed right before its down migration,
+	// so apply the up migration and remember the schema from before it
+	if analysis.GetDirection(ctx) == analysis.DirectionUp {
+		a.applyUp(migration, parseTree)
+		return nil
+	}
+
+	// an empty down migration is reported by analyzer-irreversible-migration
+	if a.before == nil || len(parseTree.Stmts) == 0 {
+		return nil
+	}
+
+	reverted := a.schema.Clone()
+	for _, statement := range parseTree.Stmts {
+		reverted.Apply(statement)
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, difference := range catalog.Diff(a.before, reverted) {
+		textLocation, changedByUp := a.changes[difference.Key]
+		if !changedByUp {
+			textLocation = pgquery.TextLocation{LineNumber: -1, LineCharPosition: -1}
+		}
+
+		var code, text string
+		switch difference.Kind {
+		case catalog.DifferenceExtra:
+			// the down migration restoring an object the up migration dropped,
+			// that no analyzed migration created, is not known to exist before the up migration
+			if !changedByUp {
+				continue
+			}
+			code = DiagnosticCodeLeftBehind
+			text = fmt.Sprintf("The up migration creates %s, but the down migration leaves it behind", difference.Object)
+		case catalog.DifferenceMissing:
+			code = DiagnosticCodeNotRestored
+			text = fmt.Sprintf("Before the up migration %s exists, but the down migration does not restore it", difference.Object)
+		case catalog.DifferenceChanged:
+			code = DiagnosticCodeChanged
+			text = fmt.Sprintf("Before the up migration %s is `%s`, but after the down migration it is `%s`", difference.Object, difference.From, difference.To)
+		}
+		diagnostics = append(diagnostics, types.Diagnostic{
+			LineNumber:   textLocation.LineNumber,
+			LinePosition: textLocation.LineCharPosition,
+			Code:         code,
+			Level:        types.DiagnosticLevelWarning,
+			Text:         text,
+		})
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - applying the up migration and then the down migration
+	// - leaves the schema exactly as it was before the up migration
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&DownMigrationInverseAnalyzer{
+			schema: catalog.New(),
+		},
+		"Errors occurred around down migration(s) that are not the inverse of their up migration",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+	"github.com/aprimetechnology/derisk-sql/pkg/catalog"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"down migration undoing the up migration",
+			[]analysistest.Migration{{
+				Up:   "CREATE TABLE a (id bigint);\nALTER TABLE a ADD COLUMN b text NOT NULL;\nCREATE INDEX a_b_idx ON a (b);",
+				Down: "DROP TABLE a;",
+			}},
+			[]string{},
+		},
+		{
+			"created objects left behind",
+			[]analysistest.Migration{
+				{Up: "CREATE TABLE a (id bigint);"},
+				{Up: "ALTER TABLE a ADD COLUMN b text;\nCREATE INDEX a_b_idx ON a (b);", Down: "DROP INDEX a_b_idx;"},
+			},
+			[]string{"2 INV-001 WARNING 1:1"},
+		},
+		{
+			"dropped column not restored",
+			[]analysistest.Migration{
+				{Up: "CREATE TABLE a (id bigint, b text);"},
+				{Up: "SELECT 1;\nALTER TABLE a DROP COLUMN b;", Down: "SELECT 1;"},
+			},
+			[]string{"2 INV-002 WARNING 2:1"},
+		},
+		{
+			"column type not restored",
+			[]analysistest.Migration{
+				{Up: "CREATE TABLE a (id int);"},
+				{Up: "ALTER TABLE a ALTER COLUMN id TYPE bigint;", Down: "ALTER TABLE a ALTER COLUMN id TYPE int;"},
+				{Up: "ALTER TABLE a ALTER COLUMN id TYPE text;", Down: "ALTER TABLE a ALTER COLUMN id TYPE bigint;\nALTER TABLE a ALTER COLUMN id SET NOT NULL;"},
+			},
+			[]string{"3 INV-003 WARNING 1:1"},
+		},
+		{
+			"enum values not restored",
+			[]analysistest.Migration{
+				{Up: "CREATE TYPE mood AS ENUM ('happy');"},
+				{Up: "ALTER TYPE mood ADD VALUE 'sad';", Down: "ALTER TYPE mood RENAME VALUE 'sad' TO 'unhappy';"},
+			},
+			[]string{"2 INV-003 WARNING 1:1"},
+		},
+		{
+			"object restored that no migration created",
+			[]analysistest.Migration{{Up: "DROP TABLE a;", Down: "CREATE TABLE a (id bigint);"}},
+			[]string{},
+		},
+		{
+			"object of the same name restored in another schema",
+			[]analysistest.Migration{
+				{Up: "CREATE TABLE app.a (id bigint);"},
+				{Up: "DROP TABLE app.a;", Down: "CREATE TABLE a (id bigint);"},
+			},
+			[]string{"2 INV-002 WARNING 1:1"},
+		},
+		{
+			"empty down migration",
+			[]analysistest.Migration{{Up: "CREATE TABLE a (id bigint);"}},
+			[]string{},
+		},
+		{
+			"unparseable up migration",
+			[]analysistest.Migration{{Up: "CREATE TABLE;", Down: "DROP TABLE a;"}},
+			[]string{"1 INV-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(nil, test.migrations...), &DownMigrationInverseAnalyzer{schema: catalog.New()}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
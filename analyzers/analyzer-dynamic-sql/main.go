@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DiagnosticCode            = "DYN-000"
+	DiagnosticCodeDoBlock     = "DYN-001"
+	DiagnosticCodeDynamic     = "DYN-002"
+	DiagnosticCodeUnparseable = "DYN-003"
+)
+
+// the plpgsql statements running a query built from a string, along with the field holding the string,
+// eg: `EXECUTE`, `FOR ... IN EXECUTE` or `RETURN QUERY EXECUTE` (but not a static `RETURN QUERY SELECT`)
+var DynamicStatements = map[string]string{
+	"dynexecute":   "query",
+	"dynfors":      "query",
+	"return_query": "dynquery",
+}
+
+// a format() placeholder, ie: `%[position$][flags][width]type`, eg: `%I`, `%1$I` or `%-10s`
+var formatPlaceholderRegexp = regexp.MustCompile(`%(?:[0-9]+\$)?-?(?:[0-9]+|\*(?:[0-9]+\$)?)?([sIL%])`)
+
+// what each format() placeholder type is replaced with, so that a format string can be parsed
+var formatPlaceholders = map[string]string{
+	"%": "%",
+	"I": "placeholder",
+	"s": "placeholder",
+	"L": "NULL",
+}
+
+// Replaces the placeholders of a format() format string with something that parses in their place,
+// returning false if it has a `%` that is not a valid placeholder
+func replaceFormatPlaceholders(format string) (string, bool) {
+	replaced := strings.Builder{}
+	last := 0
+	for _, match := range formatPlaceholderRegexp.FindAllStringSubmatchIndex(format, -1) {
+		if strings.Contains(format[last:match[0]], "%") {
+			return "", false
+		}
+		replaced.WriteString(format[last:match[0]])
+		replaced.WriteString(formatPlaceholders[format[match[2]:match[3]]])
+		last = match[1]
+	}
+	if strings.Contains(format[last:], "%") {
+		return "", false
+	}
+	replaced.WriteString(format[last:])
+	return replaced.String(), true
+}
+
+// Returns the SQL a dynamic query expression runs when it can be known statically,
+// ie: a string literal, or a format() call with a literal format string
+func GetLiteralQuery(expression string) (string, bool) {
+	parseTree, err := pg_query.Parse("SELECT " + expression)
+	if err != nil || len(parseTree.Stmts) != 1 {
+		return "", false
+	}
+	targets := parseTree.Stmts[0].Stmt.GetSelectStmt().GetTargetList()
+	if len(targets) != 1 {
+		return "", false
+	}
+	value := targets[0].GetResTarget().GetVal()
+	if literal := value.GetAConst().GetSval(); literal != nil {
+		return literal.Sval, true
+	}
+	if call := value.GetFuncCall(); call != nil && pgquery.GetUnqualifiedName(call.Funcname) == "format" && len(call.Args) > 0 {
+		if literal := call.Args[0].GetAConst().GetSval(); literal != nil {
+			return replaceFormatPlaceholders(literal.Sval)
+		}
+	}
+	return "", false
+}
+
+// Returns the kinds of the statements in a query, eg: `ALTER TABLE, UPDATE`
+func describeStatementKinds(query string) (string, error) {
+	parseTree, err := pg_query.Parse(query)
+	if err != nil {
+		return "", err
+	}
+	kinds := []string{}
+	for _, statement := range parseTree.Stmts {
+		kinds = append(kinds, pgquery.GetStatementKind(statement))
+	}
+	return strings.Join(kinds, ", "), nil
+}
+
+type DynamicSqlAnalyzer struct{}
+
+func (a *DynamicSqlAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		report := func(textLocation pgquery.TextLocation, code string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        types.DiagnosticLevelWarning,
+				Text:         text,
+			})
+		}
+
+		isDoBlock := statement.Stmt.GetDoStmt() != nil
+		description := "DO block"
+		if create := statement.Stmt.GetCreateFunctionStmt(); create != nil {
+			description = fmt.Sprintf("Function %q", strings.Join(pgquery.GetStringValues(create.Funcname), "."))
+		}
+
+		body := pgquery.GetFunctionBody(migration, statement)
+		if body == nil {
+			if isDoBlock {
+				report(textLocation, DiagnosticCodeDoBlock, "DO block can not be statically analyzed, so none of the other checks apply to it. Write its statements as plain SQL in the migration instead")
+			}
+			continue
+		}
+		// a sql body is plain SQL, which can not run dynamic SQL, any other language is not parsed at all
+		queries := []pgquery.PlPgSqlQuery{}
+		var err error
+		switch body.Language {
+		case "plpgsql":
+			queries, err = pgquery.GetPlPgSqlQueries(body.Function)
+		case "sql":
+		default:
+			err = fmt.Errorf("only plpgsql and sql bodies can be parsed, not %s", body.Language)
+		}
+
+		// a DO block's statements run right away, as part of the migration
+		if isDoBlock {
+			kinds := []string{}
+			for _, query := range queries {
+				if query.Expression {
+					continue
+				}
+				if described, err := describeStatementKinds(query.Query); err == nil {
+					kinds = append(kinds, described)
+				}
+			}
+			text := "DO block can not be statically analyzed, so none of the other checks apply to it"
+			if len(kinds) > 0 {
+				text += fmt.Sprintf(" (it runs %s)", strings.Join(kinds, ", "))
+			}
+			report(textLocation, DiagnosticCodeDoBlock, text+". Write its statements as plain SQL in the migration instead")
+		}
+		if err != nil {
+			report(
+				textLocation,
+				DiagnosticCodeUnparseable,
+				fmt.Sprintf("%s body can not be parsed, so none of the other checks apply to the statements it runs: %s", description, err),
+			)
+			continue
+		}
+
+		for _, query := range queries {
+			if field, ok := DynamicStatements[query.Statement]; !ok || query.Field != field {
+				continue
+			}
+			// without a known location in the migration, report at the start of the DO block or function
+			queryLocation := textLocation
+			if offset := body.GetQueryOffset(query); offset != -1 {
+				queryLocation = pgquery.GetTextLocation(migration, offset)
+			}
+
+			literal, ok := GetLiteralQuery(query.Query)
+			if !ok {
+				report(
+					queryLocation,
+					DiagnosticCodeDynamic,
+					fmt.Sprintf("EXECUTE of dynamic SQL `%s` can not be statically analyzed, so none of the other checks apply to it", query.Query),
+				)
+				continue
+			}
+			kinds, err := describeStatementKinds(literal)
+			if err != nil {
+				report(
+					queryLocation,
+					DiagnosticCodeUnparseable,
+					fmt.Sprintf("EXECUTE of dynamic SQL `%s` can not be statically analyzed, and can not be parsed: %s", query.Query, err),
+				)
+				continue
+			}
+			report(
+				queryLocation,
+				DiagnosticCodeDynamic,
+				fmt.Sprintf("EXECUTE of dynamic SQL `%s` can not be statically analyzed, so none of the other checks apply to the %s it runs", query.Query, kinds),
+			)
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - no DO block is used
+	// - no plpgsql function or DO block EXECUTEs dynamic SQL
+	// - every function and DO block body can be parsed
+	// - as neither can be checked by any other analyzer
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&DynamicSqlAnalyzer{},
+		"Errors occurred around DO block(s) and dynamic SQL that can not be statically analyzed",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+// Returns a plpgsql function running the given statements
+func plpgsqlFunction(statements string) string {
+	return "CREATE FUNCTION f(t text) RETURNS SETOF users AS $$\nBEGIN\n  " + statements + "\nEND;\n$$ LANGUAGE plpgsql;"
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"DO block",
+			[]analysistest.Migration{{Up: "DO $$\nBEGIN\n  UPDATE users SET a = 1;\nEND;\n$$;"}},
+			[]string{"1 DYN-001 WARNING 1:1"},
+		},
+		{
+			"DO block executing dynamic SQL",
+			[]analysistest.Migration{{Up: "DO $$\nBEGIN\n  EXECUTE 'DROP TABLE users';\nEND;\n$$;"}},
+			[]string{"1 DYN-001 WARNING 1:1", "1 DYN-002 WARNING 3:11"},
+		},
+		{
+			"DO block in another language",
+			[]analysistest.Migration{{Up: "DO LANGUAGE plpython3u $$ plpy.execute('DROP TABLE users') $$;"}},
+			[]string{"1 DYN-001 WARNING 1:1", "1 DYN-003 WARNING 1:1"},
+		},
+		{
+			"EXECUTE of a format() string",
+			[]analysistest.Migration{{Up: plpgsqlFunction("EXECUTE format('DROP TABLE %1$I', t);")}},
+			[]string{"1 DYN-002 WARNING 3:11"},
+		},
+		{
+			"RETURN QUERY EXECUTE with parameters",
+			[]analysistest.Migration{{Up: plpgsqlFunction("RETURN QUERY EXECUTE 'SELECT * FROM users WHERE email = $1' USING t;")}},
+			[]string{"1 DYN-002 WARNING 3:24"},
+		},
+		{
+			"static RETURN QUERY and statements",
+			[]analysistest.Migration{{Up: plpgsqlFunction("UPDATE users SET a = 1 WHERE email = t;\n  RETURN QUERY SELECT * FROM users;")}},
+			[]string{},
+		},
+		{
+			"EXECUTE of an unparseable literal",
+			[]analysistest.Migration{{Up: plpgsqlFunction("EXECUTE 'DROP TABEL users';")}},
+			[]string{"1 DYN-003 WARNING 3:11"},
+		},
+		{
+			"unparseable function body",
+			[]analysistest.Migration{{Up: "CREATE FUNCTION f() RETURNS void AS $$\nBEGIN\n  EXECUTE;\nEND;\n$$ LANGUAGE plpgsql;"}},
+			[]string{"1 DYN-003 WARNING 1:1"},
+		},
+		{
+			"function body in another language",
+			[]analysistest.Migration{{Up: "CREATE FUNCTION f() RETURNS void AS $$ plpy.execute('DROP TABLE users') $$ LANGUAGE plpython3u;"}},
+			[]string{"1 DYN-003 WARNING 1:1"},
+		},
+		{
+			"sql function body",
+			[]analysistest.Migration{{Up: "CREATE FUNCTION f() RETURNS void AS 'DELETE FROM users' LANGUAGE sql;"}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "DO;"}},
+			[]string{"1 DYN-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(nil, test.migrations...), &DynamicSqlAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	PostgresVersionKey               = "postgres_version"
+	EnumHotTablesKey                 = "enum_hot_tables"
+	DiagnosticCode                   = "ENM-000"
+	DiagnosticCodeAddValueInTx       = "ENM-001"
+	DiagnosticCodeNewValueUsedInTx   = "ENM-002"
+	DiagnosticCodeRenameValue        = "ENM-003"
+	DiagnosticCodeEnumColumnHotTable = "ENM-004"
+	// the first major version allowing ALTER TYPE ... ADD VALUE inside a transaction block
+	AddValueInTransactionVersion = 12
+	// assume a supported postgres version unless told otherwise
+	DefaultPostgresVersion = 16
+)
+
+type EnumColumn struct {
+	Column string
+	Type   string
+}
+
+// Returns the table a statement creates or alters, along with the enum typed columns it adds to that table
+func getEnumColumns(statement *pg_query.RawStmt, enumTypes map[string]bool) (*pg_query.RangeVar, []EnumColumn) {
+	columns := []EnumColumn{}
+	addColumn := func(colDef *pg_query.ColumnDef, name string) {
+		if typeName := pgquery.GetTypeName(colDef.GetTypeName()); enumTypes[typeName] {
+			columns = append(columns, EnumColumn{Column: name, Type: typeName})
+		}
+	}
+
+	if create := statement.Stmt.GetCreateStmt(); create != nil {
+		for _, element := range create.TableElts {
+			if colDef := element.GetColumnDef(); colDef != nil {
+				addColumn(colDef, colDef.Colname)
+			}
+		}
+		return create.Relation, columns
+	}
+
+	if alter := statement.Stmt.GetAlterTableStmt(); alter != nil {
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			switch alterCmd.GetSubtype() {
+			case pg_query.AlterTableType_AT_AddColumn:
+				colDef := alterCmd.GetDef().GetColumnDef()
+				addColumn(colDef, colDef.GetColname())
+			case pg_query.AlterTableType_AT_AlterColumnType:
+				addColumn(alterCmd.GetDef().GetColumnDef(), alterCmd.Name)
+			}
+		}
+		return alter.Relation, columns
+	}
+	return nil, columns
+}
+
+// the enum typed columns of each table, keyed by (possibly schema qualified) table name then column name
+type EnumColumns map[string]map[string]string
+
+func (c EnumColumns) Clone() EnumColumns {
+	clone := EnumColumns{}
+	for table, columns := range c {
+		clone[table] = map[string]string{}
+		for column, enum := range columns {
+			clone[table][column] = enum
+		}
+	}
+	return clone
+}
+
+// keep track of the enum typed columns of each table as the schema changes
+func (c EnumColumns) Apply(statement *pg_query.RawStmt, enumTypes map[string]bool) {
+	if drop := statement.Stmt.GetDropStmt(); drop != nil && drop.RemoveType == pg_query.ObjectType_OBJECT_TABLE {
+		for _, object := range drop.Objects {
+			delete(c, pgquery.GetObjectName(object))
+		}
+	}
+	relation, columns := getEnumColumns(statement, enumTypes)
+	if relation == nil {
+		return
+	}
+	table := pgquery.GetRangeVarName(relation)
+	if c[table] == nil || statement.Stmt.GetCreateStmt() != nil {
+		c[table] = map[string]string{}
+	}
+	for _, column := range columns {
+		c[table][column.Column] = column.Type
+	}
+}
+
+// Reports whether a statement uses a value of an enum type, ie: a string constant equal to the value that is
+// cast to the enum type, compared to a column of the enum type, or assigned to a column of the enum type
+// eg: `'new_value'::mood`, `WHERE mood IN ('new_value')`, `SET mood = 'new_value'` or `mood mood DEFAULT 'new_value'`
+func ReferencesValue(statement *pg_query.RawStmt, enum string, value string, enumColumns EnumColumns) bool {
+	isValue := func(node *pg_query.Node) bool {
+		constant := node.GetAConst().GetSval()
+		return constant != nil && constant.Sval == value
+	}
+	// comparisons can not be resolved to a table, so match a column of the enum type on any table
+	columnNames := map[string]bool{}
+	for _, columns := range enumColumns {
+		for column, columnEnum := range columns {
+			if columnEnum == enum {
+				columnNames[column] = true
+			}
+		}
+	}
+	isEnumColumn := func(table *pg_query.RangeVar, column string) bool {
+		return enumColumns[pgquery.GetRangeVarName(table)][column] == enum
+	}
+
+	found := false
+	pgquery.Walk(statement, func(node *pg_query.Node) bool {
+		switch {
+		case node.GetTypeCast() != nil:
+			cast := node.GetTypeCast()
+			found = isValue(cast.Arg) && pgquery.GetTypeName(cast.TypeName) == enum
+		case node.GetAExpr() != nil:
+			expr := node.GetAExpr()
+			for _, operands := range [][2]*pg_query.Node{{expr.Lexpr, expr.Rexpr}, {expr.Rexpr, expr.Lexpr}} {
+				if !columnNames[pgquery.GetUnqualifiedName(operands[0].GetColumnRef().GetFields())] {
+					continue
+				}
+				values := []*pg_query.Node{operands[1]}
+				if list := operands[1].GetList(); list != nil {
+					values = list.Items
+				}
+				for _, operand := range values {
+					found = found || isValue(operand)
+				}
+			}
+		case node.GetColumnDef() != nil:
+			colDef := node.GetColumnDef()
+			if pgquery.GetTypeName(colDef.TypeName) != enum {
+				break
+			}
+			for _, constraint := range colDef.Constraints {
+				found = found || (constraint.GetConstraint().GetContype() == pg_query.ConstrType_CONSTR_DEFAULT && isValue(constraint.GetConstraint().RawExpr))
+			}
+		case node.GetUpdateStmt() != nil:
+			update := node.GetUpdateStmt()
+			for _, target := range update.TargetList {
+				found = found || (isEnumColumn(update.Relation, target.GetResTarget().Name) && isValue(target.GetResTarget().Val))
+			}
+		case node.GetInsertStmt() != nil:
+			insert := node.GetInsertStmt()
+			for _, row := range insert.GetSelectStmt().GetSelectStmt().GetValuesLists() {
+				for i, item := range row.GetList().GetItems() {
+					found = found || (i < len(insert.Cols) && isEnumColumn(insert.Relation, insert.Cols[i].GetResTarget().Name) && isValue(item))
+				}
+			}
+		case node.GetAlterTableStmt() != nil:
+			alter := node.GetAlterTableStmt()
+			for _, cmd := range alter.Cmds {
+				alterCmd := cmd.GetAlterTableCmd()
+				found = found || (alterCmd.GetSubtype() == pg_query.AlterTableType_AT_ColumnDefault && isEnumColumn(alter.Relation, alterCmd.Name) && isValue(alterCmd.Def))
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+type EnumChangesAnalyzer struct {
+	// the enum types created by all the up migrations analyzed so far
+	enumTypes map[string]bool
+	// the enum typed columns created by all the up migrations analyzed so far
+	enumColumns EnumColumns
+}
+
+func (a *EnumChangesAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	version, err := analysis.GetConfigInt(ctx, PostgresVersionKey, DefaultPostgresVersion)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         err.Error(),
+		}}
+	}
+	hotTables := map[string]bool{}
+	if tables, ok := analysis.GetConfigList(ctx, EnumHotTablesKey); ok {
+		for _, table := range tables {
+			hotTables[table] = true
+		}
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// only up migrations build up the schema across migrations,
+	// a down migration only sees its own changes on top of its up migration
+	enumTypes, enumColumns := a.enumTypes, a.enumColumns
+	if analysis.GetDirection(ctx) != analysis.DirectionUp {
+		enumTypes, enumColumns = map[string]bool{}, a.enumColumns.Clone()
+		for name := range a.enumTypes {
+			enumTypes[name] = true
+		}
+	}
+
+	// dbmate runs every migration in a transaction block unless `transaction:false` is set
+	inTransaction := options["transaction"] != "false"
+
+	diagnostics := []types.Diagnostic{}
+	for i, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		report := func(code string, level string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        level,
+				Text:         text,
+			})
+		}
+
+		if create := statement.Stmt.GetCreateEnumStmt(); create != nil {
+			enumTypes[pgquery.GetUnqualifiedName(create.TypeName)] = true
+		}
+		if drop := statement.Stmt.GetDropStmt(); drop != nil && drop.RemoveType == pg_query.ObjectType_OBJECT_TYPE {
+			for _, object := range drop.Objects {
+				delete(enumTypes, pgquery.GetTypeName(object.GetTypeName()))
+			}
+		}
+
+		if alter := statement.Stmt.GetAlterEnumStmt(); alter != nil {
+			enum := strings.Join(pgquery.GetStringValues(alter.TypeName), ".")
+
+			// rename value -> existing rows and application code still use the old value
+			if alter.OldVal != "" {
+				report(
+					DiagnosticCodeRenameValue,
+					types.DiagnosticLevelWarning,
+					fmt.Sprintf(
+						"RENAME VALUE %q of enum %q to %q breaks every application replica still running code that reads or writes %q during a rolling deploy. Add the new value, migrate rows and application code to it, and stop using the old value instead (enum values can not be safely removed)",
+						alter.OldVal,
+						enum,
+						alter.NewVal,
+						alter.OldVal,
+					),
+				)
+				continue
+			}
+
+			if !inTransaction {
+				continue
+			}
+			if version < AddValueInTransactionVersion {
+				report(
+					DiagnosticCodeAddValueInTx,
+					types.DiagnosticLevelFatal,
+					fmt.Sprintf(
+						"ALTER TYPE %q ADD VALUE %q statement is happening within a transaction block! This is prohibited before Postgres %d (config key %q is %d), set `transaction:false` on the migration",
+						enum,
+						alter.NewVal,
+						AddValueInTransactionVersion,
+						PostgresVersionKey,
+						version,
+					),
+				)
+				continue
+			}
+			// the enum typed columns as of each later statement
+			laterColumns := enumColumns.Clone()
+			for _, later := range parseTree.Stmts[i+1:] {
+				if ReferencesValue(later, strings.ToLower(pgquery.GetUnqualifiedName(alter.TypeName)), alter.NewVal, laterColumns) {
+					report(
+						DiagnosticCodeNewValueUsedInTx,
+						types.DiagnosticLevelFatal,
+						fmt.Sprintf(
+							"ALTER TYPE %q ADD VALUE %q is referenced later in the same transaction, which fails with `unsafe use of new value`. Add the value in its own migration, or set `transaction:false` on the migration",
+							enum,
+							alter.NewVal,
+						),
+					)
+					break
+				}
+				laterColumns.Apply(later, enumTypes)
+			}
+		}
+
+		enumColumns.Apply(statement, enumTypes)
+
+		// enum columns on hot tables -> suggest a lookup table
+		if len(hotTables) > 0 {
+			relation, columns := getEnumColumns(statement, enumTypes)
+			if relation != nil && (hotTables[pgquery.GetRangeVarName(relation)] || hotTables[relation.Relname]) {
+				for _, column := range columns {
+					report(
+						DiagnosticCodeEnumColumnHotTable,
+						types.DiagnosticLevelWarning,
+						fmt.Sprintf(
+							"Column %q of hot table %q uses enum %q, whose values can never be removed or reordered without rewriting the table. Consider a lookup table referenced by a foreign key instead",
+							column.Column,
+							pgquery.GetRangeVarName(relation),
+							column.Type,
+						),
+					)
+				}
+			}
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any ALTER TYPE ... ADD VALUE operation can run (and its value is not used) inside a TRANSACTION block
+	// - no ALTER TYPE ... RENAME VALUE operation is performed
+	// - no enum typed column is added to a configured hot table
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&EnumChangesAnalyzer{
+			enumTypes:   map[string]bool{},
+			enumColumns: EnumColumns{},
+		},
+		"Errors occurred around enum type change statement(s)",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
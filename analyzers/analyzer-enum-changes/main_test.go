@@ -0,0 +1,115 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+const createMood = "CREATE TYPE mood AS ENUM ('happy', 'sad');\nCREATE TABLE users (id bigint, mood mood);"
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"ADD VALUE within a transaction",
+			nil,
+			[]analysistest.Migration{{Up: createMood}, {Up: "ALTER TYPE mood ADD VALUE 'ok';"}},
+			[]string{},
+		},
+		{
+			"ADD VALUE within a transaction before Postgres 12",
+			map[string]string{PostgresVersionKey: "11"},
+			[]analysistest.Migration{{Up: createMood}, {Up: "ALTER TYPE mood ADD VALUE 'ok';"}},
+			[]string{"2 ENM-001 FATAL 1:1"},
+		},
+		{
+			"ADD VALUE outside of a transaction before Postgres 12",
+			map[string]string{PostgresVersionKey: "11"},
+			[]analysistest.Migration{{Up: createMood}, {Up: "ALTER TYPE mood ADD VALUE 'ok';", NoTransaction: true}},
+			[]string{},
+		},
+		{
+			"new value cast later in the same transaction",
+			nil,
+			[]analysistest.Migration{{Up: createMood}, {Up: "ALTER TYPE mood ADD VALUE 'ok';\nSELECT 'ok'::mood;"}},
+			[]string{"2 ENM-002 FATAL 1:1"},
+		},
+		{
+			"new value assigned later in the same transaction",
+			nil,
+			[]analysistest.Migration{{Up: createMood}, {Up: "ALTER TYPE mood ADD VALUE 'ok';\nUPDATE users SET mood = 'ok' WHERE id = 1;"}},
+			[]string{"2 ENM-002 FATAL 1:1"},
+		},
+		{
+			"new value compared later in the same transaction",
+			nil,
+			[]analysistest.Migration{{Up: createMood}, {Up: "ALTER TYPE mood ADD VALUE 'ok';\nDELETE FROM users WHERE mood IN ('ok');"}},
+			[]string{"2 ENM-002 FATAL 1:1"},
+		},
+		{
+			"same string assigned to a column of another type",
+			nil,
+			[]analysistest.Migration{{Up: createMood + "\nCREATE TABLE notes (body text);"}, {Up: "ALTER TYPE mood ADD VALUE 'ok';\nUPDATE notes SET body = 'ok';"}},
+			[]string{},
+		},
+		{
+			"new value used outside of a transaction",
+			nil,
+			[]analysistest.Migration{{Up: createMood}, {Up: "ALTER TYPE mood ADD VALUE 'ok';\nSELECT 'ok'::mood;", NoTransaction: true}},
+			[]string{},
+		},
+		{
+			"RENAME VALUE",
+			nil,
+			[]analysistest.Migration{{Up: createMood}, {Up: "ALTER TYPE mood RENAME VALUE 'sad' TO 'unhappy';", NoTransaction: true}},
+			[]string{"2 ENM-003 WARNING 1:1"},
+		},
+		{
+			"enum column added to a hot table",
+			map[string]string{EnumHotTablesKey: "orders"},
+			[]analysistest.Migration{{Up: createMood}, {Up: "ALTER TABLE orders ADD COLUMN mood mood;\nALTER TABLE users ADD COLUMN other mood;"}},
+			[]string{"2 ENM-004 WARNING 1:1"},
+		},
+		{
+			"text column added to a hot table",
+			map[string]string{EnumHotTablesKey: "orders"},
+			[]analysistest.Migration{{Up: createMood}, {Up: "ALTER TABLE orders ADD COLUMN mood text;"}},
+			[]string{},
+		},
+		{
+			"malformed config",
+			map[string]string{PostgresVersionKey: "latest"},
+			[]analysistest.Migration{{Up: createMood}},
+			[]string{"1 ENM-000 FATAL -1:-1", "1 ENM-000 FATAL -1:-1"},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TYPE mood ADD;"}},
+			[]string{"1 ENM-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(
+				analysistest.Input(test.config, test.migrations...),
+				&EnumChangesAnalyzer{enumTypes: map[string]bool{}, enumColumns: EnumColumns{}},
+				"",
+				[]string{},
+			)
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
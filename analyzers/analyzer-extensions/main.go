@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	ExtensionAllowlistKey           = "extension_allowlist"
+	DiagnosticCode                  = "EXT-000"
+	DiagnosticCodeNotAllowed        = "EXT-001"
+	DiagnosticCodeVersionNotAllowed = "EXT-002"
+	DiagnosticCodeIfNotExists       = "EXT-003"
+	DiagnosticCodeUpdate            = "EXT-004"
+)
+
+// the extensions (and, optionally, their versions) available on the target database
+// an extension allowed without any version may be installed at any version
+type Allowlist map[string][]string
+
+// Parses allowed extension names and optional name:version pairs, eg: `pg_trgm,postgis:3.4,postgis:3.5`
+func ParseAllowlist(values []string) (Allowlist, error) {
+	allowlist := Allowlist{}
+	for _, value := range values {
+		name, version, hasVersion := strings.Cut(value, ":")
+		name, version = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(version)
+		if name == "" || (hasVersion && version == "") {
+			return nil, fmt.Errorf("error parsing config key %q value %q: expected an `extension` name or an `extension:version` pair", ExtensionAllowlistKey, value)
+		}
+		if _, ok := allowlist[name]; !ok {
+			allowlist[name] = []string{}
+		}
+		if hasVersion {
+			allowlist[name] = append(allowlist[name], version)
+		}
+	}
+	return allowlist, nil
+}
+
+// Reports whether a version of an extension is allowed, an empty version being the extension's default version
+func (a Allowlist) AllowsVersion(name string, version string) bool {
+	versions := a[strings.ToLower(name)]
+	if version == "" || len(versions) == 0 {
+		return true
+	}
+	for _, allowed := range versions {
+		if allowed == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the version an extension is created or updated to, or "" for the extension's default version
+func GetVersion(options []*pg_query.Node) string {
+	for _, option := range options {
+		if option.GetDefElem().GetDefname() == "new_version" {
+			return option.GetDefElem().GetArg().GetString_().GetSval()
+		}
+	}
+	return ""
+}
+
+type ExtensionsAnalyzer struct{}
+
+func (a *ExtensionsAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	// without an allowlist any extension is allowed
+	var allowlist Allowlist
+	if values, ok := analysis.GetConfigList(ctx, ExtensionAllowlistKey); ok {
+		var err error
+		if allowlist, err = ParseAllowlist(values); err != nil {
+			return []types.Diagnostic{types.Diagnostic{
+				LineNumber:   -1,
+				LinePosition: -1,
+				Code:         DiagnosticCode,
+				Level:        types.DiagnosticLevelFatal,
+				Text:         err.Error(),
+			}}
+		}
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		report := func(code string, level string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        level,
+				Text:         text,
+			})
+		}
+
+		// the extension and version are checked the same way whether it is created or updated
+		checkAllowed := func(verb string, name string, version string) {
+			switch {
+			case allowlist == nil:
+			case allowlist[strings.ToLower(name)] == nil:
+				report(
+					DiagnosticCodeNotAllowed,
+					types.DiagnosticLevelFatal,
+					fmt.Sprintf(
+						"%s %q is not in config key %q, so it is not available on the target database (or needs a superuser to install). Add it to the allowlist once it is confirmed to be available",
+						verb,
+						name,
+						ExtensionAllowlistKey,
+					),
+				)
+			case !allowlist.AllowsVersion(name, version):
+				report(
+					DiagnosticCodeVersionNotAllowed,
+					types.DiagnosticLevelFatal,
+					fmt.Sprintf(
+						"%s %q uses version %q, but config key %q only allows version(s) %s",
+						verb,
+						name,
+						version,
+						ExtensionAllowlistKey,
+						strings.Join(allowlist[strings.ToLower(name)], ", "),
+					),
+				)
+			}
+		}
+
+		switch {
+		case statement.Stmt.GetCreateExtensionStmt() != nil:
+			create := statement.Stmt.GetCreateExtensionStmt()
+			checkAllowed("CREATE EXTENSION", create.Extname, GetVersion(create.Options))
+			if !create.IfNotExists {
+				report(
+					DiagnosticCodeIfNotExists,
+					types.DiagnosticLevelWarning,
+					fmt.Sprintf(
+						"CREATE EXTENSION %q fails if the extension is already installed (eg: by another application, or a rerun migration). Use `CREATE EXTENSION IF NOT EXISTS %s` instead",
+						create.Extname,
+						create.Extname,
+					),
+				)
+			}
+		case statement.Stmt.GetAlterExtensionStmt() != nil:
+			alter := statement.Stmt.GetAlterExtensionStmt()
+			version := GetVersion(alter.Options)
+			checkAllowed("ALTER EXTENSION", alter.Extname, version)
+			target := "its default version"
+			if version != "" {
+				target = fmt.Sprintf("version %q", version)
+			}
+			report(
+				DiagnosticCodeUpdate,
+				types.DiagnosticLevelWarning,
+				fmt.Sprintf(
+					"ALTER EXTENSION %q UPDATE to %s can not be rolled back to the previous version, and may take locks on (or rewrite) objects using the extension. Make sure the upgrade has been tested against the target database",
+					alter.Extname,
+					target,
+				),
+			)
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any CREATE EXTENSION or ALTER EXTENSION ... UPDATE operation
+	// - uses an extension (and version) in the configured allowlist
+	// - and any CREATE EXTENSION operation uses IF NOT EXISTS
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&ExtensionsAnalyzer{},
+		"Errors occurred around extension creation and upgrade statement(s)",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"any extension without an allowlist",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE EXTENSION IF NOT EXISTS pg_trgm;\nCREATE EXTENSION IF NOT EXISTS postgis VERSION '3.4';"}},
+			[]string{},
+		},
+		{
+			"CREATE EXTENSION without IF NOT EXISTS",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE EXTENSION pg_trgm;"}},
+			[]string{"1 EXT-003 WARNING 1:1"},
+		},
+		{
+			"extension not in the allowlist",
+			map[string]string{ExtensionAllowlistKey: "pg_trgm"},
+			[]analysistest.Migration{{Up: "CREATE EXTENSION IF NOT EXISTS PG_TRGM;\nCREATE EXTENSION IF NOT EXISTS plperlu;"}},
+			[]string{"1 EXT-001 FATAL 2:1"},
+		},
+		{
+			"extension version not in the allowlist",
+			map[string]string{ExtensionAllowlistKey: "postgis:3.4,postgis:3.5"},
+			[]analysistest.Migration{{Up: "CREATE EXTENSION IF NOT EXISTS postgis VERSION '3.5';\nCREATE EXTENSION IF NOT EXISTS postgis VERSION '3.3';\nCREATE EXTENSION IF NOT EXISTS postgis;"}},
+			[]string{"1 EXT-002 FATAL 2:1"},
+		},
+		{
+			"ALTER EXTENSION UPDATE",
+			map[string]string{ExtensionAllowlistKey: "postgis:3.4"},
+			[]analysistest.Migration{{Up: "ALTER EXTENSION postgis UPDATE TO '3.4';\nALTER EXTENSION postgis UPDATE TO '3.5';"}},
+			[]string{"1 EXT-004 WARNING 1:1", "1 EXT-002 FATAL 2:1", "1 EXT-004 WARNING 2:1"},
+		},
+		{
+			"DROP EXTENSION",
+			map[string]string{ExtensionAllowlistKey: "pg_trgm"},
+			[]analysistest.Migration{{Up: "DROP EXTENSION IF EXISTS hstore;"}},
+			[]string{},
+		},
+		{
+			"malformed config",
+			map[string]string{ExtensionAllowlistKey: "postgis:"},
+			[]analysistest.Migration{{Up: "CREATE EXTENSION IF NOT EXISTS postgis;"}},
+			[]string{"1 EXT-000 FATAL -1:-1", "1 EXT-000 FATAL -1:-1"},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE EXTENSION;"}},
+			[]string{"1 EXT-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(test.config, test.migrations...), &ExtensionsAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
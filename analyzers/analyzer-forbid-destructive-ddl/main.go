@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DestructiveAllowKey       = "destructive_allow"
+	DestructiveDownWarningKey = "destructive_down_warning"
+	DiagnosticCode            = "DST-000"
+	DiagnosticCodeDropTable   = "DST-001"
+	DiagnosticCodeDropSchema  = "DST-002"
+	DiagnosticCodeDropColumn  = "DST-003"
+	DiagnosticCodeDropType    = "DST-004"
+	DiagnosticCodeTruncate    = "DST-005"
+)
+
+type DestructiveInfo struct {
+	Statement      string
+	DiagnosticCode string
+}
+
+var DropCodeToInfo = map[pg_query.ObjectType]DestructiveInfo{
+	pg_query.ObjectType_OBJECT_TABLE: DestructiveInfo{
+		Statement:      "DROP TABLE",
+		DiagnosticCode: DiagnosticCodeDropTable,
+	},
+	pg_query.ObjectType_OBJECT_SCHEMA: DestructiveInfo{
+		Statement:      "DROP SCHEMA",
+		DiagnosticCode: DiagnosticCodeDropSchema,
+	},
+	pg_query.ObjectType_OBJECT_TYPE: DestructiveInfo{
+		Statement:      "DROP TYPE",
+		DiagnosticCode: DiagnosticCodeDropType,
+	},
+}
+
+// Reports whether an object matches any allowlisted glob pattern (eg: `tmp_*` or `scratch.*`)
+// patterns are matched against both the fully qualified name and the unqualified name
+func IsAllowed(allowlist []string, qualifiedName string, name string) bool {
+	for _, pattern := range allowlist {
+		for _, candidate := range []string{qualifiedName, name} {
+			if matched, _ := path.Match(pattern, candidate); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type ForbidDestructiveDDLAnalyzer struct{}
+
+func (a *ForbidDestructiveDDLAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	allowlist, _ := analysis.GetConfigList(ctx, DestructiveAllowKey)
+	for _, pattern := range allowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return []types.Diagnostic{types.Diagnostic{
+				LineNumber:   -1,
+				LinePosition: -1,
+				Code:         DiagnosticCode,
+				Level:        types.DiagnosticLevelFatal,
+				Text:         fmt.Errorf("error compiling config key %q pattern %q: %w", DestructiveAllowKey, pattern, err).Error(),
+			}}
+		}
+	}
+	downWarning, err := analysis.GetConfigBool(ctx, DestructiveDownWarningKey, true)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         err.Error(),
+		}}
+	}
+
+	// destructive statements are expected in down migrations, so they are downgraded unless configured otherwise
+	level := types.DiagnosticLevelFatal
+	if downWarning && analysis.GetDirection(ctx) == analysis.DirectionDown {
+		level = types.DiagnosticLevelWarning
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		// every destructive statement found is checked against the allowlist
+		report := func(code string, description string, qualifiedName string, name string) {
+			if IsAllowed(allowlist, qualifiedName, name) {
+				return
+			}
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        level,
+				Text: fmt.Sprintf(
+					"%s permanently deletes data. If this is intended, add %q to config key %q",
+					description,
+					qualifiedName,
+					DestructiveAllowKey,
+				),
+			})
+		}
+
+		// drop table, schema, type -> object names
+		if drop := statement.Stmt.GetDropStmt(); drop != nil {
+			if info, ok := DropCodeToInfo[drop.RemoveType]; ok {
+				for _, object := range drop.Objects {
+					qualifiedName := pgquery.GetObjectName(object)
+					description := fmt.Sprintf("%s %q", info.Statement, qualifiedName)
+					if drop.Behavior == pg_query.DropBehavior_DROP_CASCADE {
+						description += " CASCADE (which also drops every dependent object)"
+					}
+					name := qualifiedName[strings.LastIndex(qualifiedName, ".")+1:]
+					report(info.DiagnosticCode, description, qualifiedName, name)
+				}
+			}
+		}
+
+		// truncate -> table names
+		if truncate := statement.Stmt.GetTruncateStmt(); truncate != nil {
+			for _, relation := range truncate.Relations {
+				rangeVar := relation.GetRangeVar()
+				qualifiedName := pgquery.GetRangeVarName(rangeVar)
+				report(DiagnosticCodeTruncate, fmt.Sprintf("TRUNCATE %q", qualifiedName), qualifiedName, rangeVar.GetRelname())
+			}
+		}
+
+		// alter table -> dropped column names
+		if alter := statement.Stmt.GetAlterTableStmt(); alter != nil {
+			table := pgquery.GetRangeVarName(alter.GetRelation())
+			for _, cmd := range alter.Cmds {
+				alterCmd := cmd.GetAlterTableCmd()
+				if alterCmd.GetSubtype() != pg_query.AlterTableType_AT_DropColumn {
+					continue
+				}
+				qualifiedName := table + "." + alterCmd.Name
+				report(DiagnosticCodeDropColumn, fmt.Sprintf("DROP COLUMN %q of table %q", alterCmd.Name, table), qualifiedName, alterCmd.Name)
+			}
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any DROP TABLE, DROP SCHEMA, DROP TYPE, DROP COLUMN or TRUNCATE operation
+	// - only affects objects that are explicitly allowlisted
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&ForbidDestructiveDDLAnalyzer{},
+		"Errors occurred around destructive DROP or TRUNCATE statement(s)",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"destructive statements",
+			nil,
+			[]analysistest.Migration{{Up: `DROP TABLE users;
+DROP SCHEMA app CASCADE;
+ALTER TABLE orgs DROP COLUMN name;
+DROP TYPE status;
+TRUNCATE events;`}},
+			[]string{"1 DST-001 FATAL 1:1", "1 DST-002 FATAL 2:1", "1 DST-003 FATAL 3:1", "1 DST-004 FATAL 4:1", "1 DST-005 FATAL 5:1"},
+		},
+		{
+			"every dropped object is reported",
+			nil,
+			[]analysistest.Migration{{Up: "DROP TABLE users, orgs;"}},
+			[]string{"1 DST-001 FATAL 1:1", "1 DST-001 FATAL 1:1"},
+		},
+		{
+			"other drops are not destructive",
+			nil,
+			[]analysistest.Migration{{Up: "DROP INDEX users_email_idx;\nDROP VIEW active_users;"}},
+			[]string{},
+		},
+		{
+			"allowlisted objects",
+			map[string]string{DestructiveAllowKey: "tmp_*,app.old_users,orgs.name"},
+			[]analysistest.Migration{{Up: `DROP TABLE tmp_users, app.tmp_orgs;
+DROP TABLE app.old_users;
+DROP TABLE old_users;
+ALTER TABLE orgs DROP COLUMN name;`}},
+			[]string{"1 DST-001 FATAL 3:1"},
+		},
+		{
+			"down migrations are warnings",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE users (id bigint);", Down: "DROP TABLE users;"}},
+			[]string{"1 DST-001 WARNING 3:1"},
+		},
+		{
+			"down migrations are fatal when configured",
+			map[string]string{DestructiveDownWarningKey: "false"},
+			[]analysistest.Migration{{Up: "CREATE TABLE users (id bigint);", Down: "DROP TABLE users;"}},
+			[]string{"1 DST-001 FATAL 3:1"},
+		},
+		{
+			"malformed config",
+			map[string]string{DestructiveAllowKey: "tmp_["},
+			[]analysistest.Migration{{Up: "SELECT 1;"}},
+			[]string{"1 DST-000 FATAL -1:-1", "1 DST-000 FATAL -1:-1"},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "DROP TABLE;"}},
+			[]string{"1 DST-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(test.config, test.migrations...), &ForbidDestructiveDDLAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
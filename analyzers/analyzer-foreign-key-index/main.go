@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const DiagnosticCode = "IND-005"
+
+type Index struct {
+	// the possibly schema qualified name of the index, or "" for the index of a UNIQUE or PRIMARY KEY constraint
+	// (which can only be dropped along with its constraint)
+	Name string
+	// the possibly schema qualified name of the indexed table
+	Table string
+	// the indexed columns in order, with "" for any expression
+	Columns []string
+}
+
+// Reports whether the index's leading columns are exactly the given columns (in any order),
+// so a lookup on those columns (eg: a DELETE on the referenced table) can use the index
+func (i Index) Covers(columns []string) bool {
+	if len(i.Columns) < len(columns) {
+		return false
+	}
+	leading := map[string]bool{}
+	for _, column := range i.Columns[:len(columns)] {
+		leading[column] = true
+	}
+	for _, column := range columns {
+		if !leading[column] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the index a UNIQUE or PRIMARY KEY constraint implicitly builds, if any
+func getConstraintIndex(table string, constraint *pg_query.Constraint, column string) *Index {
+	switch constraint.GetContype() {
+	case pg_query.ConstrType_CONSTR_PRIMARY, pg_query.ConstrType_CONSTR_UNIQUE:
+	default:
+		return nil
+	}
+	columns := pgquery.GetStringValues(constraint.Keys)
+	if len(columns) == 0 && column != "" {
+		columns = []string{column}
+	}
+	return &Index{Table: table, Columns: columns}
+}
+
+// Returns the name postgres generates for an unnamed index, eg: `users_email_idx`
+func getIndexName(create *pg_query.IndexStmt, columns []string) string {
+	if create.Idxname != "" {
+		return create.Idxname
+	}
+	names := []string{}
+	for _, column := range columns {
+		if column == "" {
+			column = "expr"
+		}
+		names = append(names, column)
+	}
+	return fmt.Sprintf("%s_%s_idx", create.GetRelation().GetRelname(), strings.Join(names, "_"))
+}
+
+// Returns every index built by a statement, explicitly or implicitly by a UNIQUE or PRIMARY KEY constraint
+func GetIndexes(statement *pg_query.RawStmt) []Index {
+	indexes := []Index{}
+	add := func(index *Index) {
+		if index != nil {
+			indexes = append(indexes, *index)
+		}
+	}
+
+	// a partial index can not be used for every lookup
+	if create := pgquery.GetCreateIndexStatement(statement); create != nil && create.WhereClause == nil {
+		index := Index{Table: pgquery.GetRangeVarName(create.Relation)}
+		for _, param := range create.IndexParams {
+			index.Columns = append(index.Columns, param.GetIndexElem().GetName())
+		}
+		// an index is created in the schema of its table
+		index.Name = pgquery.GetRangeVarName(&pg_query.RangeVar{Schemaname: create.GetRelation().GetSchemaname(), Relname: getIndexName(create, index.Columns)})
+		add(&index)
+	}
+
+	if create := statement.Stmt.GetCreateStmt(); create != nil {
+		table := pgquery.GetRangeVarName(create.Relation)
+		for _, element := range create.TableElts {
+			add(getConstraintIndex(table, element.GetConstraint(), ""))
+			for _, constraint := range element.GetColumnDef().GetConstraints() {
+				add(getConstraintIndex(table, constraint.GetConstraint(), element.GetColumnDef().Colname))
+			}
+		}
+	}
+
+	if alter := statement.Stmt.GetAlterTableStmt(); alter != nil {
+		table := pgquery.GetRangeVarName(alter.Relation)
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			switch alterCmd.GetSubtype() {
+			case pg_query.AlterTableType_AT_AddConstraint:
+				// USING INDEX attaches an index that was already counted when it was built
+				if constraint := alterCmd.GetDef().GetConstraint(); constraint.Indexname == "" {
+					add(getConstraintIndex(table, constraint, ""))
+				}
+			case pg_query.AlterTableType_AT_AddColumn:
+				colDef := alterCmd.GetDef().GetColumnDef()
+				for _, constraint := range colDef.GetConstraints() {
+					add(getConstraintIndex(table, constraint.GetConstraint(), colDef.Colname))
+				}
+			}
+		}
+	}
+	return indexes
+}
+
+// Returns the indexes left after a statement drops any of them, by DROP INDEX or by dropping their table
+func dropIndexes(indexes []Index, statement *pg_query.RawStmt) []Index {
+	drop := statement.Stmt.GetDropStmt()
+	if drop == nil || (drop.RemoveType != pg_query.ObjectType_OBJECT_INDEX && drop.RemoveType != pg_query.ObjectType_OBJECT_TABLE) {
+		return indexes
+	}
+	dropped := map[string]bool{}
+	for _, object := range drop.Objects {
+		dropped[pgquery.GetObjectName(object)] = true
+	}
+	remaining := []Index{}
+	for _, index := range indexes {
+		if drop.RemoveType == pg_query.ObjectType_OBJECT_INDEX && dropped[index.Name] {
+			continue
+		}
+		if drop.RemoveType == pg_query.ObjectType_OBJECT_TABLE && dropped[index.Table] {
+			continue
+		}
+		remaining = append(remaining, index)
+	}
+	return remaining
+}
+
+// Returns every index built across all the up migrations, and not dropped by any of them
+func CollectIndexes(migrations []types.ParsedMigration) []Index {
+	indexes := []Index{}
+	for _, migration := range migrations {
+		parseTree, err := pg_query.Parse(migration.Up)
+		if err != nil {
+			// reported when the migration itself is analyzed
+			continue
+		}
+		for _, statement := range parseTree.Stmts {
+			indexes = dropIndexes(indexes, statement)
+			indexes = append(indexes, GetIndexes(statement)...)
+		}
+	}
+	return indexes
+}
+
+type ForeignKey struct {
+	Table      *pg_query.RangeVar
+	Columns    []string
+	References *pg_query.RangeVar
+}
+
+// Returns every foreign key constraint added by a statement
+func GetForeignKeys(statement *pg_query.RawStmt) []ForeignKey {
+	foreignKeys := []ForeignKey{}
+	add := func(table *pg_query.RangeVar, constraint *pg_query.Constraint, column string) {
+		if constraint.GetContype() != pg_query.ConstrType_CONSTR_FOREIGN {
+			return
+		}
+		// a column constraint (ie: `col int REFERENCES t`) does not list its own column
+		columns := pgquery.GetStringValues(constraint.FkAttrs)
+		if len(columns) == 0 && column != "" {
+			columns = []string{column}
+		}
+		foreignKeys = append(foreignKeys, ForeignKey{
+			Table:      table,
+			Columns:    columns,
+			References: constraint.Pktable,
+		})
+	}
+
+	if create := statement.Stmt.GetCreateStmt(); create != nil {
+		for _, element := range create.TableElts {
+			add(create.Relation, element.GetConstraint(), "")
+			for _, constraint := range element.GetColumnDef().GetConstraints() {
+				add(create.Relation, constraint.GetConstraint(), element.GetColumnDef().Colname)
+			}
+		}
+	}
+
+	if alter := statement.Stmt.GetAlterTableStmt(); alter != nil {
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			switch alterCmd.GetSubtype() {
+			case pg_query.AlterTableType_AT_AddConstraint:
+				add(alter.Relation, alterCmd.GetDef().GetConstraint(), "")
+			case pg_query.AlterTableType_AT_AddColumn:
+				colDef := alterCmd.GetDef().GetColumnDef()
+				for _, constraint := range colDef.GetConstraints() {
+					add(alter.Relation, constraint.GetConstraint(), colDef.Colname)
+				}
+			}
+		}
+	}
+	return foreignKeys
+}
+
+type ForeignKeyIndexAnalyzer struct {
+	// every index built (and not dropped) across all the up migrations, so that
+	// an index added in a later migration still counts
+	indexes []Index
+}
+
+func (a *ForeignKeyIndexAnalyzer) isCovered(foreignKey ForeignKey) bool {
+	for _, index := range a.indexes {
+		if index.Table == pgquery.GetRangeVarName(foreignKey.Table) && index.Covers(foreignKey.Columns) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ForeignKeyIndexAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	// a down migration re-adding a foreign key restores the schema as it was before the up migration,
+	// which is checked by whichever earlier migration first added it
+	if analysis.GetDirection(ctx) != analysis.DirectionUp {
+		return nil
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		for _, foreignKey := range GetForeignKeys(statement) {
+			if len(foreignKey.Columns) == 0 || a.isCovered(foreignKey) {
+				continue
+			}
+			byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+			textLocation := pgquery.GetTextLocation(migration, byteOffset)
+			table := pgquery.GetRangeVarName(foreignKey.Table)
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         DiagnosticCode,
+				Level:        types.DiagnosticLevelWarning,
+				Text: fmt.Sprintf(
+					"FOREIGN KEY (%s) on table %q referencing table %q has no index with those leading columns, so every DELETE or key UPDATE on %q scans %q. Add `CREATE INDEX CONCURRENTLY %s_%s_idx ON %s (%s);` in a migration with `transaction:false`",
+					strings.Join(foreignKey.Columns, ", "),
+					table,
+					pgquery.GetRangeVarName(foreignKey.References),
+					pgquery.GetRangeVarName(foreignKey.References),
+					table,
+					foreignKey.Table.GetRelname(),
+					strings.Join(foreignKey.Columns, "_"),
+					table,
+					strings.Join(foreignKey.Columns, ", "),
+				),
+			})
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that across all migrations:
+	// - any FOREIGN KEY constraint added
+	// - has an index whose leading columns are the foreign key's columns
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&ForeignKeyIndexAnalyzer{
+			indexes: CollectIndexes(input.Migrations),
+		},
+		"Errors occurred around FOREIGN KEY constraint(s) without a supporting index",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"foreign key without an index",
+			[]analysistest.Migration{{Up: "CREATE TABLE orders (id bigint PRIMARY KEY, user_id bigint REFERENCES users);"}},
+			[]string{"1 IND-005 WARNING 1:1"},
+		},
+		{
+			"foreign key with an index in the same migration",
+			[]analysistest.Migration{{Up: "ALTER TABLE orders ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES users;\nCREATE INDEX ON orders (user_id);"}},
+			[]string{},
+		},
+		{
+			"foreign key with an index in a later migration",
+			[]analysistest.Migration{
+				{Up: "ALTER TABLE orders ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES users;"},
+				{Up: "CREATE INDEX CONCURRENTLY orders_user_id_idx ON orders (user_id, created_at);", NoTransaction: true},
+			},
+			[]string{},
+		},
+		{
+			"index whose leading column is not the foreign key",
+			[]analysistest.Migration{{Up: "CREATE INDEX ON orders (created_at, user_id);\nALTER TABLE orders ADD FOREIGN KEY (user_id) REFERENCES users;"}},
+			[]string{"1 IND-005 WARNING 2:1"},
+		},
+		{
+			"partial index",
+			[]analysistest.Migration{{Up: "CREATE INDEX ON orders (user_id) WHERE user_id IS NOT NULL;\nALTER TABLE orders ADD FOREIGN KEY (user_id) REFERENCES users;"}},
+			[]string{"1 IND-005 WARNING 2:1"},
+		},
+		{
+			"only the leading column of a PRIMARY KEY constraint is indexed",
+			[]analysistest.Migration{{Up: "CREATE TABLE memberships (user_id bigint REFERENCES users, org_id bigint REFERENCES orgs, PRIMARY KEY (user_id, org_id));"}},
+			[]string{"1 IND-005 WARNING 1:1"},
+		},
+		{
+			"index dropped in a later migration",
+			[]analysistest.Migration{
+				{Up: "CREATE INDEX orders_user_id_idx ON orders (user_id);\nALTER TABLE orders ADD FOREIGN KEY (user_id) REFERENCES users;"},
+				{Up: "DROP INDEX orders_user_id_idx;"},
+			},
+			[]string{"1 IND-005 WARNING 2:1"},
+		},
+		{
+			"index on a table of the same name in another schema",
+			[]analysistest.Migration{{Up: "CREATE INDEX ON app.orders (user_id);\nALTER TABLE orders ADD FOREIGN KEY (user_id) REFERENCES users;"}},
+			[]string{"1 IND-005 WARNING 2:1"},
+		},
+		{
+			"foreign key re-added by a down migration",
+			[]analysistest.Migration{{Up: "ALTER TABLE orders DROP CONSTRAINT fk;", Down: "ALTER TABLE orders ADD CONSTRAINT fk FOREIGN KEY (user_id) REFERENCES users;"}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "ALTER TABLE orders ADD FOREIGN KEY;"}},
+			[]string{"1 IND-005 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			input := analysistest.Input(nil, test.migrations...)
+			output := analysis.DoSimpleAnalysis(input, &ForeignKeyIndexAnalyzer{indexes: CollectIndexes(input.Migrations)}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	// shared with analyzer-add-column-volatile-default
+	VolatileDefaultAllowlistKey        = "volatile_default_allowlist"
+	DiagnosticCode                     = "FUN-000"
+	DiagnosticCodeSecurityDefiner      = "FUN-001"
+	DiagnosticCodeImmutableUsesTable   = "FUN-002"
+	DiagnosticCodeUnparseableBody      = "FUN-003"
+	DiagnosticCodeLockingStatement     = "FUN-004"
+	DiagnosticCodeDestructiveStatement = "FUN-005"
+	DiagnosticCodeUnfilteredWrite      = "FUN-006"
+	DiagnosticCodeTableRewrite         = "FUN-007"
+	DiagnosticCodeTableScan            = "FUN-008"
+)
+
+// EmbeddedStatement is a SQL statement within a function body, along with where it is in the migration
+type EmbeddedStatement struct {
+	Statement    *pg_query.RawStmt
+	TextLocation pgquery.TextLocation
+	// whether the statement is a plpgsql expression (eg: an IF condition) parsed as a SELECT
+	Expression bool
+}
+
+// Reports whether a function is SECURITY DEFINER, and whether it sets its own search_path
+func getSecurity(create *pg_query.CreateFunctionStmt) (bool, bool) {
+	securityDefiner, setsSearchPath := false, false
+	for _, node := range create.Options {
+		option := node.GetDefElem()
+		switch option.GetDefname() {
+		case "security":
+			securityDefiner = option.GetArg().GetBoolean().GetBoolval()
+		case "set":
+			setsSearchPath = setsSearchPath || option.GetArg().GetVariableSetStmt().GetName() == "search_path"
+		}
+	}
+	return securityDefiner, setsSearchPath
+}
+
+// Returns the statements within a SQL or plpgsql function body, including plpgsql expressions parsed as a SELECT
+// a function body that can not be parsed returns an error
+func GetEmbeddedStatements(migration string, statement *pg_query.RawStmt) ([]EmbeddedStatement, error) {
+	body := pgquery.GetFunctionBody(migration, statement)
+	if body == nil || (body.Language != "sql" && body.Language != "plpgsql") {
+		return nil, nil
+	}
+
+	// a body not found in the migration (eg: within single quotes) falls back to the function's location
+	fallback := pgquery.GetTextLocation(migration, pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation)))
+	getTextLocation := func(offset int) pgquery.TextLocation {
+		if offset == -1 {
+			return fallback
+		}
+		return pgquery.GetTextLocation(migration, offset)
+	}
+
+	statements := []EmbeddedStatement{}
+	if body.Language == "sql" {
+		parseTree, err := pg_query.Parse(body.Body)
+		if err != nil {
+			return nil, err
+		}
+		for _, embedded := range parseTree.Stmts {
+			offset := -1
+			if body.Offset != -1 {
+				offset = body.Offset + pgquery.SkipWhitespaceAndComments(body.Body, int(embedded.StmtLocation))
+			}
+			statements = append(statements, EmbeddedStatement{
+				Statement:    embedded,
+				TextLocation: getTextLocation(offset),
+			})
+		}
+		return statements, nil
+	}
+
+	queries, err := pgquery.GetPlPgSqlQueries(body.Function)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range queries {
+		parseTree, err := query.Parse()
+		if err != nil {
+			return nil, err
+		}
+		for _, embedded := range parseTree.Stmts {
+			statements = append(statements, EmbeddedStatement{
+				Statement:    embedded,
+				TextLocation: getTextLocation(body.GetQueryOffset(query)),
+				Expression:   query.Expression,
+			})
+		}
+	}
+	return statements, nil
+}
+
+// TableScan is an ALTER TABLE command that scans or rewrites every row of the table
+type TableScan struct {
+	Code  string
+	Level string
+	// the command, eg: `ADD COLUMN "c" with a DEFAULT calling volatile function random()`
+	Command string
+	// what the command does to the table, ie: `rewriting` or `scanning`
+	Effect string
+}
+
+// Returns the commands of an ALTER TABLE statement that scan or rewrite every row of the table,
+// classified the same way as the analyzers checking ALTER TABLE statements in migrations
+func GetTableScans(alter *pg_query.AlterTableStmt, allowlist map[string]bool) []TableScan {
+	scans := []TableScan{}
+	rewrite := func(command string) {
+		scans = append(scans, TableScan{Code: DiagnosticCodeTableRewrite, Level: types.DiagnosticLevelFatal, Command: command, Effect: "rewriting"})
+	}
+	scan := func(command string) {
+		scans = append(scans, TableScan{Code: DiagnosticCodeTableScan, Level: types.DiagnosticLevelWarning, Command: command, Effect: "scanning"})
+	}
+
+	for _, cmd := range alter.GetCmds() {
+		alterCmd := cmd.GetAlterTableCmd()
+		switch alterCmd.GetSubtype() {
+		case pg_query.AlterTableType_AT_AddColumn:
+			colDef := alterCmd.GetDef().GetColumnDef()
+			if typeName := pgquery.GetTypeName(colDef.GetTypeName()); pgquery.SerialTypes[typeName] {
+				rewrite(fmt.Sprintf("ADD COLUMN %q of type %s", colDef.GetColname(), typeName))
+			}
+			for _, node := range colDef.GetConstraints() {
+				constraint := node.GetConstraint()
+				switch constraint.GetContype() {
+				case pg_query.ConstrType_CONSTR_IDENTITY:
+					rewrite(fmt.Sprintf("ADD COLUMN %q as an IDENTITY column", colDef.GetColname()))
+				case pg_query.ConstrType_CONSTR_DEFAULT:
+					if kind, function := pgquery.ClassifyDefault(constraint.RawExpr, allowlist); kind == pgquery.DefaultKindVolatile {
+						rewrite(fmt.Sprintf("ADD COLUMN %q with a DEFAULT calling volatile function %s()", colDef.GetColname(), function))
+					}
+				}
+			}
+			for _, constraint := range pgquery.GetValidatedConstraints(alterCmd) {
+				scan(fmt.Sprintf("ADD COLUMN %q with an inline %s constraint", colDef.GetColname(), pgquery.ValidatedConstraintTypes[constraint.Contype]))
+			}
+		case pg_query.AlterTableType_AT_AddConstraint:
+			for _, constraint := range pgquery.GetValidatedConstraints(alterCmd) {
+				scan(fmt.Sprintf("ADD %s constraint without NOT VALID", pgquery.ValidatedConstraintTypes[constraint.Contype]))
+			}
+		case pg_query.AlterTableType_AT_SetNotNull:
+			scan(fmt.Sprintf("ALTER COLUMN %q SET NOT NULL", alterCmd.Name))
+		}
+	}
+	return scans
+}
+
+// Returns the table a statement writes, or else the first table it reads,
+// along with whether it is written, or "" if it uses none
+func getAccessedTable(statement *pg_query.RawStmt) (string, bool) {
+	// the target of a write is a bare RangeVar, rather than a Node seen by Walk
+	var target *pg_query.RangeVar
+	switch {
+	case statement.Stmt.GetInsertStmt() != nil:
+		target = statement.Stmt.GetInsertStmt().Relation
+	case statement.Stmt.GetUpdateStmt() != nil:
+		target = statement.Stmt.GetUpdateStmt().Relation
+	case statement.Stmt.GetDeleteStmt() != nil:
+		target = statement.Stmt.GetDeleteStmt().Relation
+	case statement.Stmt.GetMergeStmt() != nil:
+		target = statement.Stmt.GetMergeStmt().Relation
+	}
+	if target != nil {
+		return pgquery.GetRangeVarName(target), true
+	}
+
+	table := ""
+	pgquery.Walk(statement, func(node *pg_query.Node) bool {
+		if rangeVar := node.GetRangeVar(); rangeVar != nil && table == "" {
+			table = pgquery.GetRangeVarName(rangeVar)
+		}
+		return table == ""
+	})
+	return table, false
+}
+
+// FunctionsAnalyzer checks the SQL embedded in function bodies with checks of its own (statements taking locks,
+// destructive statements, and writes without a WHERE clause), along with the other analyzers' classifiers of ALTER TABLE
+// commands scanning or rewriting the table (volatile defaults, SET NOT NULL, and constraints added without NOT VALID).
+// The checks depending on the migration around a statement (eg: the tables created or the lock_timeout set so far)
+// are not run, as they do not apply to a body run on every call.
+type FunctionsAnalyzer struct{}
+
+func (a *FunctionsAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	allowlist := map[string]bool{}
+	if names, ok := analysis.GetConfigList(ctx, VolatileDefaultAllowlistKey); ok {
+		for _, name := range names {
+			allowlist[strings.ToLower(name)] = true
+		}
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		create := statement.Stmt.GetCreateFunctionStmt()
+		if create == nil {
+			continue
+		}
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+		function := strings.Join(pgquery.GetStringValues(create.Funcname), ".")
+
+		report := func(textLocation pgquery.TextLocation, code string, level string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        level,
+				Text:         text,
+			})
+		}
+
+		// security definer -> the caller controls which schemas (and so which objects) the function uses
+		if securityDefiner, setsSearchPath := getSecurity(create); securityDefiner && !setsSearchPath {
+			report(
+				textLocation,
+				DiagnosticCodeSecurityDefiner,
+				types.DiagnosticLevelFatal,
+				fmt.Sprintf(
+					"SECURITY DEFINER function %q does not set its own search_path, so any caller able to create objects in a schema on their search_path can make it run their code with the owner's privileges. Add `SET search_path = pg_catalog, pg_temp` (and schema qualify the objects it uses)",
+					function,
+				),
+			)
+		}
+
+		statements, err := GetEmbeddedStatements(migration, statement)
+		if err != nil {
+			report(
+				textLocation,
+				DiagnosticCodeUnparseableBody,
+				types.DiagnosticLevelWarning,
+				fmt.Sprintf("The body of function %q can not be parsed, so it can not be analyzed: %s", function, err),
+			)
+			continue
+		}
+
+		volatility := pgquery.GetOption(create.Options, "volatility").GetArg().GetString_().GetSval()
+		for _, embedded := range statements {
+			if volatility == "immutable" {
+				table, written := getAccessedTable(embedded.Statement)
+				text := fmt.Sprintf(
+					"IMMUTABLE function %q reads table %q, but postgres may reuse its results (eg: in indexes, or in cached plans) after the table changes. Mark the function STABLE instead",
+					function,
+					table,
+				)
+				if written {
+					text = fmt.Sprintf(
+						"IMMUTABLE function %q writes table %q, but postgres may call it once and reuse its result (eg: while planning a query), skipping the write. Mark the function VOLATILE instead",
+						function,
+						table,
+					)
+				}
+				if table != "" {
+					report(embedded.TextLocation, DiagnosticCodeImmutableUsesTable, types.DiagnosticLevelWarning, text)
+					// a single diagnostic is enough to fix the function's volatility
+					volatility = ""
+				}
+			}
+			if embedded.Expression {
+				continue
+			}
+
+			scans := GetTableScans(embedded.Statement.Stmt.GetAlterTableStmt(), allowlist)
+			switch {
+			case len(scans) > 0:
+				for _, scan := range scans {
+					report(
+						embedded.TextLocation,
+						scan.Code,
+						scan.Level,
+						fmt.Sprintf(
+							"Function %q runs ALTER TABLE %q %s, %s every row of the table while holding its locks every time the function is called. Run schema changes in migrations instead",
+							function,
+							pgquery.GetRangeVarName(embedded.Statement.Stmt.GetAlterTableStmt().Relation),
+							scan.Command,
+							scan.Effect,
+						),
+					)
+				}
+			case embedded.Statement.Stmt.GetAlterTableStmt() != nil,
+				embedded.Statement.Stmt.GetIndexStmt() != nil,
+				embedded.Statement.Stmt.GetLockStmt() != nil:
+				report(
+					embedded.TextLocation,
+					DiagnosticCodeLockingStatement,
+					types.DiagnosticLevelWarning,
+					fmt.Sprintf(
+						"Function %q runs %s, taking locks on the table every time the function is called (and outside of what is checked for this migration). Run schema changes in migrations instead",
+						function,
+						pgquery.GetStatementKind(embedded.Statement),
+					),
+				)
+			case embedded.Statement.Stmt.GetDropStmt() != nil,
+				embedded.Statement.Stmt.GetTruncateStmt() != nil:
+				report(
+					embedded.TextLocation,
+					DiagnosticCodeDestructiveStatement,
+					types.DiagnosticLevelFatal,
+					fmt.Sprintf(
+						"Function %q runs destructive %s every time the function is called. Drop objects in migrations instead",
+						function,
+						pgquery.GetStatementKind(embedded.Statement),
+					),
+				)
+			case embedded.Statement.Stmt.GetUpdateStmt() != nil && embedded.Statement.Stmt.GetUpdateStmt().WhereClause == nil:
+				report(
+					embedded.TextLocation,
+					DiagnosticCodeUnfilteredWrite,
+					types.DiagnosticLevelWarning,
+					fmt.Sprintf(
+						"Function %q runs UPDATE on table %q without a WHERE clause, changing every row of the table every time the function is called",
+						function,
+						pgquery.GetRangeVarName(embedded.Statement.Stmt.GetUpdateStmt().Relation),
+					),
+				)
+			case embedded.Statement.Stmt.GetDeleteStmt() != nil && embedded.Statement.Stmt.GetDeleteStmt().WhereClause == nil:
+				report(
+					embedded.TextLocation,
+					DiagnosticCodeUnfilteredWrite,
+					types.DiagnosticLevelWarning,
+					fmt.Sprintf(
+						"Function %q runs DELETE on table %q without a WHERE clause, deleting every row of the table every time the function is called",
+						function,
+						pgquery.GetRangeVarName(embedded.Statement.Stmt.GetDeleteStmt().Relation),
+					),
+				)
+			}
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any SECURITY DEFINER function sets its own search_path
+	// - any IMMUTABLE function does not read or write tables, including within plpgsql expressions
+	// - any SQL or plpgsql function body does not lock tables, drop objects, or write every row of a table
+	// - nor scan or rewrite a table with ALTER TABLE, as classified by the analyzers checking ALTER TABLE in migrations
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&FunctionsAnalyzer{},
+		"Errors occurred around function and procedure definition(s)",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+// Returns a plpgsql function running the given statements
+func plpgsqlFunction(statements string) string {
+	return "CREATE FUNCTION f() RETURNS void AS $$\nBEGIN\n  " + statements + "\nEND;\n$$ LANGUAGE plpgsql;"
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"SECURITY DEFINER function without a search_path",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE FUNCTION f() RETURNS int AS 'SELECT 1' LANGUAGE sql SECURITY DEFINER;"}},
+			[]string{"1 FUN-001 FATAL 1:1"},
+		},
+		{
+			"SECURITY DEFINER function setting its search_path",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE FUNCTION f() RETURNS int AS 'SELECT 1' LANGUAGE sql SECURITY DEFINER SET search_path = pg_catalog, pg_temp;"}},
+			[]string{},
+		},
+		{
+			"IMMUTABLE function reading a table",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE FUNCTION f() RETURNS bigint AS $$\n  SELECT count(*) FROM users;\n$$ LANGUAGE sql IMMUTABLE;"}},
+			[]string{"1 FUN-002 WARNING 2:3"},
+		},
+		{
+			"IMMUTABLE function reading a table within a plpgsql expression",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE FUNCTION f() RETURNS boolean AS $$\nBEGIN\n  RETURN EXISTS (SELECT 1 FROM users);\nEND;\n$$ LANGUAGE plpgsql IMMUTABLE;"}},
+			[]string{"1 FUN-002 WARNING 3:10"},
+		},
+		{
+			"unparseable function body",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE FUNCTION f() RETURNS int AS 'SELEC 1' LANGUAGE sql;"}},
+			[]string{"1 FUN-003 WARNING 1:1"},
+		},
+		{
+			"locking, destructive and unfiltered statements",
+			nil,
+			[]analysistest.Migration{{Up: plpgsqlFunction("LOCK TABLE users;\n  TRUNCATE users;\n  UPDATE users SET a = 1;\n  DELETE FROM users WHERE id = 1;")}},
+			[]string{"1 FUN-004 WARNING 3:3", "1 FUN-005 FATAL 4:3", "1 FUN-006 WARNING 5:3"},
+		},
+		{
+			"ALTER TABLE rewriting or scanning the table",
+			nil,
+			[]analysistest.Migration{{Up: plpgsqlFunction("ALTER TABLE users ADD COLUMN a uuid DEFAULT gen_random_uuid();\n  ALTER TABLE users ALTER COLUMN b SET NOT NULL;")}},
+			[]string{"1 FUN-007 FATAL 3:3", "1 FUN-008 WARNING 4:3"},
+		},
+		{
+			"ALTER TABLE with a non-volatile default",
+			nil,
+			[]analysistest.Migration{{Up: plpgsqlFunction("ALTER TABLE users ADD COLUMN a timestamptz DEFAULT now();")}},
+			[]string{"1 FUN-004 WARNING 3:3"},
+		},
+		{
+			"ALTER TABLE with an allowlisted volatile default",
+			map[string]string{VolatileDefaultAllowlistKey: "gen_random_uuid"},
+			[]analysistest.Migration{{Up: plpgsqlFunction("ALTER TABLE users ADD COLUMN a uuid DEFAULT gen_random_uuid();")}},
+			[]string{"1 FUN-004 WARNING 3:3"},
+		},
+		{
+			"function body in another language",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE FUNCTION f() RETURNS void AS $$ DROP TABLE users; $$ LANGUAGE plpython3u;"}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE FUNCTION f;"}},
+			[]string{"1 FUN-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(test.config, test.migrations...), &FunctionsAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
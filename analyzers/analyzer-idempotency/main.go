@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	CheckCreateTableKey        = "idempotency_create_table"
+	CheckCreateIndexKey        = "idempotency_create_index"
+	CheckCreateSchemaKey       = "idempotency_create_schema"
+	CheckAddColumnKey          = "idempotency_add_column"
+	CheckDropKey               = "idempotency_drop"
+	DiagnosticCode             = "IDM-000"
+	DiagnosticCodeCreateTable  = "IDM-001"
+	DiagnosticCodeCreateIndex  = "IDM-002"
+	DiagnosticCodeCreateSchema = "IDM-003"
+	DiagnosticCodeAddColumn    = "IDM-004"
+	DiagnosticCodeDrop         = "IDM-005"
+)
+
+type IdempotencyAnalyzer struct{}
+
+func (a *IdempotencyAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	// every kind of statement is checked unless turned off, so teams may adopt the checks one kind at a time
+	checks := map[string]bool{}
+	for _, key := range []string{CheckCreateTableKey, CheckCreateIndexKey, CheckCreateSchemaKey, CheckAddColumnKey, CheckDropKey} {
+		check, err := analysis.GetConfigBool(ctx, key, true)
+		if err != nil {
+			return []types.Diagnostic{types.Diagnostic{
+				LineNumber:   -1,
+				LinePosition: -1,
+				Code:         DiagnosticCode,
+				Level:        types.DiagnosticLevelFatal,
+				Text:         err.Error(),
+			}}
+		}
+		checks[key] = check
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		report := func(code string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        types.DiagnosticLevelWarning,
+				Text:         text,
+			})
+		}
+
+		switch {
+		case statement.Stmt.GetCreateStmt() != nil:
+			create := statement.Stmt.GetCreateStmt()
+			if checks[CheckCreateTableKey] && !create.IfNotExists {
+				report(
+					DiagnosticCodeCreateTable,
+					fmt.Sprintf(
+						"CREATE TABLE %q fails when the migration is rerun after a partial failure. Use `CREATE TABLE IF NOT EXISTS` instead",
+						pgquery.GetRangeVarName(create.Relation),
+					),
+				)
+			}
+		case statement.Stmt.GetIndexStmt() != nil:
+			create := statement.Stmt.GetIndexStmt()
+			if !checks[CheckCreateIndexKey] || create.IfNotExists {
+				continue
+			}
+			// IF NOT EXISTS requires an index name, otherwise a rerun creates a second index
+			if create.Idxname == "" {
+				report(
+					DiagnosticCodeCreateIndex,
+					fmt.Sprintf(
+						"CREATE INDEX without a name on table %q creates a duplicate index when the migration is rerun after a partial failure. Name the index and use `CREATE INDEX IF NOT EXISTS` instead",
+						pgquery.GetRangeVarName(create.Relation),
+					),
+				)
+				continue
+			}
+			report(
+				DiagnosticCodeCreateIndex,
+				fmt.Sprintf(
+					"CREATE INDEX %q fails when the migration is rerun after a partial failure. Use `CREATE INDEX IF NOT EXISTS` instead",
+					create.Idxname,
+				),
+			)
+		case statement.Stmt.GetCreateSchemaStmt() != nil:
+			create := statement.Stmt.GetCreateSchemaStmt()
+			if checks[CheckCreateSchemaKey] && !create.IfNotExists {
+				report(
+					DiagnosticCodeCreateSchema,
+					fmt.Sprintf(
+						"CREATE SCHEMA %q fails when the migration is rerun after a partial failure. Use `CREATE SCHEMA IF NOT EXISTS` instead",
+						create.Schemaname,
+					),
+				)
+			}
+		case statement.Stmt.GetDropStmt() != nil:
+			drop := statement.Stmt.GetDropStmt()
+			if checks[CheckDropKey] && !drop.MissingOk {
+				names := []string{}
+				for _, object := range drop.Objects {
+					names = append(names, pgquery.GetObjectName(object))
+				}
+				report(
+					DiagnosticCodeDrop,
+					fmt.Sprintf(
+						"DROP %s %s fails when the migration is rerun after a partial failure. Use `DROP %s IF EXISTS` instead",
+						pgquery.GetObjectTypeName(drop.RemoveType),
+						strings.Join(names, ", "),
+						pgquery.GetObjectTypeName(drop.RemoveType),
+					),
+				)
+			}
+		case statement.Stmt.GetAlterTableStmt() != nil:
+			alter := statement.Stmt.GetAlterTableStmt()
+			for _, cmd := range alter.Cmds {
+				alterCmd := cmd.GetAlterTableCmd()
+				if alterCmd.MissingOk {
+					continue
+				}
+				switch alterCmd.GetSubtype() {
+				case pg_query.AlterTableType_AT_AddColumn:
+					if checks[CheckAddColumnKey] {
+						report(
+							DiagnosticCodeAddColumn,
+							fmt.Sprintf(
+								"ADD COLUMN %q to table %q fails when the migration is rerun after a partial failure. Use `ADD COLUMN IF NOT EXISTS` instead",
+								alterCmd.GetDef().GetColumnDef().GetColname(),
+								pgquery.GetRangeVarName(alter.Relation),
+							),
+						)
+					}
+				case pg_query.AlterTableType_AT_DropColumn, pg_query.AlterTableType_AT_DropConstraint:
+					if checks[CheckDropKey] {
+						object := "COLUMN"
+						if alterCmd.GetSubtype() == pg_query.AlterTableType_AT_DropConstraint {
+							object = "CONSTRAINT"
+						}
+						report(
+							DiagnosticCodeDrop,
+							fmt.Sprintf(
+								"DROP %s %q from table %q fails when the migration is rerun after a partial failure. Use `DROP %s IF EXISTS` instead",
+								object,
+								alterCmd.Name,
+								pgquery.GetRangeVarName(alter.Relation),
+								object,
+							),
+						)
+					}
+				}
+			}
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any CREATE TABLE, CREATE INDEX, CREATE SCHEMA or ADD COLUMN operation uses IF NOT EXISTS
+	// - any DROP operation uses IF EXISTS
+	// - so that the migration can be safely rerun after a partial failure
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&IdempotencyAnalyzer{},
+		"Errors occurred around statement(s) that can not be safely rerun",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"statements that can not be rerun",
+			nil,
+			[]analysistest.Migration{{
+				Up:   "CREATE SCHEMA app;\nCREATE TABLE app.users (id bigint);\nCREATE INDEX users_id_idx ON app.users (id);\nALTER TABLE app.users ADD COLUMN email text;",
+				Down: "DROP SCHEMA app;",
+			}},
+			[]string{"1 IDM-003 WARNING 1:1", "1 IDM-001 WARNING 2:1", "1 IDM-002 WARNING 3:1", "1 IDM-004 WARNING 4:1", "1 IDM-005 WARNING 6:1"},
+		},
+		{
+			"statements that can be rerun",
+			nil,
+			[]analysistest.Migration{{
+				Up:   "CREATE SCHEMA IF NOT EXISTS app;\nCREATE TABLE IF NOT EXISTS app.users (id bigint);\nCREATE INDEX IF NOT EXISTS users_id_idx ON app.users (id);\nALTER TABLE app.users ADD COLUMN IF NOT EXISTS email text;",
+				Down: "DROP SCHEMA IF EXISTS app;",
+			}},
+			[]string{},
+		},
+		{
+			"unnamed index",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE INDEX ON users (email);"}},
+			[]string{"1 IDM-002 WARNING 1:1"},
+		},
+		{
+			"columns and constraints dropped",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE users DROP COLUMN email, DROP CONSTRAINT IF EXISTS users_email_key;\nALTER TABLE users DROP CONSTRAINT users_pkey;"}},
+			[]string{"1 IDM-005 WARNING 1:1", "1 IDM-005 WARNING 2:1"},
+		},
+		{
+			"checks turned off",
+			map[string]string{CheckCreateTableKey: "false", CheckDropKey: "false"},
+			[]analysistest.Migration{{Up: "CREATE TABLE users (id bigint);\nCREATE INDEX users_id_idx ON users (id);", Down: "DROP TABLE users;"}},
+			[]string{"1 IDM-002 WARNING 2:1"},
+		},
+		{
+			"malformed config",
+			map[string]string{CheckAddColumnKey: "off"},
+			[]analysistest.Migration{{Up: "CREATE TABLE IF NOT EXISTS users (id bigint);"}},
+			[]string{"1 IDM-000 FATAL -1:-1", "1 IDM-000 FATAL -1:-1"},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE SCHEMA;"}},
+			[]string{"1 IDM-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(test.config, test.migrations...), &IdempotencyAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
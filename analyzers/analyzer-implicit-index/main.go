@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const DiagnosticCode = "IND-004"
+
+type ImplicitIndexInfo struct {
+	Constraint string
+	// the suffix postgres appends to the table name when naming the index
+	NameSuffix string
+}
+
+var ConstraintCodeToInfo = map[pg_query.ConstrType]ImplicitIndexInfo{
+	pg_query.ConstrType_CONSTR_UNIQUE: ImplicitIndexInfo{
+		Constraint: "UNIQUE",
+		NameSuffix: "key",
+	},
+	pg_query.ConstrType_CONSTR_PRIMARY: ImplicitIndexInfo{
+		Constraint: "PRIMARY KEY",
+		NameSuffix: "pkey",
+	},
+}
+
+// Returns the name of the index a UNIQUE or PRIMARY KEY constraint builds,
+// mirroring the name postgres generates if the constraint is unnamed
+func GetIndexName(table string, constraint *pg_query.Constraint, columns []string) string {
+	if constraint.Conname != "" {
+		return constraint.Conname
+	}
+	info := ConstraintCodeToInfo[constraint.Contype]
+	if constraint.Contype == pg_query.ConstrType_CONSTR_PRIMARY {
+		return fmt.Sprintf("%s_%s", table, info.NameSuffix)
+	}
+	return fmt.Sprintf("%s_%s_%s", table, strings.Join(columns, "_"), info.NameSuffix)
+}
+
+// Returns the statements to run instead, so the index is built without blocking writes
+func GetSuggestionText(table string, relname string, constraint *pg_query.Constraint, columns []string) string {
+	info := ConstraintCodeToInfo[constraint.Contype]
+	indexName := GetIndexName(relname, constraint, columns)
+	return fmt.Sprintf(
+		"`CREATE UNIQUE INDEX CONCURRENTLY %s ON %s (%s);` in a migration with `transaction:false`, then `ALTER TABLE %s ADD CONSTRAINT %s %s USING INDEX %s;`",
+		indexName,
+		table,
+		strings.Join(columns, ", "),
+		table,
+		indexName,
+		info.Constraint,
+		indexName,
+	)
+}
+
+type ImplicitIndexAnalyzer struct{}
+
+func (a *ImplicitIndexAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// tables created within this same migration are empty, so building an index on them is harmless
+	createdTables := map[string]bool{}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		if create := statement.Stmt.GetCreateStmt(); create != nil {
+			createdTables[pgquery.GetRangeVarName(create.Relation)] = true
+		}
+
+		alter := statement.Stmt.GetAlterTableStmt()
+		if alter == nil || createdTables[pgquery.GetRangeVarName(alter.Relation)] {
+			continue
+		}
+		table := pgquery.GetRangeVarName(alter.Relation)
+		relname := alter.GetRelation().GetRelname()
+
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			switch alterCmd.GetSubtype() {
+			// add constraint -> UNIQUE or PRIMARY KEY over existing columns
+			case pg_query.AlterTableType_AT_AddConstraint:
+				constraint := alterCmd.GetDef().GetConstraint()
+				info, ok := ConstraintCodeToInfo[constraint.GetContype()]
+				// USING INDEX attaches an index that was already built
+				if !ok || constraint.Indexname != "" {
+					continue
+				}
+				columns := pgquery.GetStringValues(constraint.Keys)
+				diagnostics = append(diagnostics, types.Diagnostic{
+					LineNumber:   textLocation.LineNumber,
+					LinePosition: textLocation.LineCharPosition,
+					Code:         DiagnosticCode,
+					Level:        types.DiagnosticLevelWarning,
+					Text: fmt.Sprintf(
+						"ADD CONSTRAINT ... %s on table %q builds a unique index without CONCURRENTLY, blocking all writes to the table until it finishes. Instead, run %s",
+						info.Constraint,
+						table,
+						GetSuggestionText(table, relname, constraint, columns),
+					),
+				})
+
+			// add column -> inline UNIQUE or PRIMARY KEY on the new column
+			case pg_query.AlterTableType_AT_AddColumn:
+				columnDef := alterCmd.GetDef().GetColumnDef()
+				for _, node := range columnDef.GetConstraints() {
+					constraint := node.GetConstraint()
+					info, ok := ConstraintCodeToInfo[constraint.GetContype()]
+					if !ok {
+						continue
+					}
+					columns := []string{columnDef.Colname}
+					diagnostics = append(diagnostics, types.Diagnostic{
+						LineNumber:   textLocation.LineNumber,
+						LinePosition: textLocation.LineCharPosition,
+						Code:         DiagnosticCode,
+						Level:        types.DiagnosticLevelWarning,
+						Text: fmt.Sprintf(
+							"ADD COLUMN %q ... %s on table %q builds a unique index without CONCURRENTLY, blocking all writes to the table until it finishes. Add the column without %s first, then run %s",
+							columnDef.Colname,
+							info.Constraint,
+							table,
+							info.Constraint,
+							GetSuggestionText(table, relname, constraint, columns),
+						),
+					})
+				}
+			}
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any ADD CONSTRAINT or ADD COLUMN operation on an existing table
+	// - does not implicitly build a UNIQUE or PRIMARY KEY index without CONCURRENTLY
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&ImplicitIndexAnalyzer{},
+		"Errors occurred around UNIQUE or PRIMARY KEY constraint(s) implicitly building an index without CONCURRENTLY",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
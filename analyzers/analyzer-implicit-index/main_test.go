@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"UNIQUE and PRIMARY KEY constraints",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);\nALTER TABLE orgs ADD PRIMARY KEY (id);"}},
+			[]string{"1 IND-004 WARNING 1:1", "1 IND-004 WARNING 2:1"},
+		},
+		{
+			"inline constraint on a new column",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD COLUMN email text UNIQUE;"}},
+			[]string{"1 IND-004 WARNING 1:1"},
+		},
+		{
+			"constraint using an index built concurrently",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE USING INDEX users_email_idx;"}},
+			[]string{},
+		},
+		{
+			"constraints not building an index",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD CONSTRAINT users_age_check CHECK (age > 0);\nALTER TABLE users ADD COLUMN a int NOT NULL;"}},
+			[]string{},
+		},
+		{
+			"table created in the same migration",
+			[]analysistest.Migration{{Up: "CREATE TABLE app.users (email text);\nALTER TABLE app.users ADD CONSTRAINT users_email_key UNIQUE (email);"}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD UNIQUE;"}},
+			[]string{"1 IND-004 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(nil, test.migrations...), &ImplicitIndexAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetIndexName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		constraint *pg_query.Constraint
+		columns    []string
+		expected   string
+	}{
+		{"named", &pg_query.Constraint{Contype: pg_query.ConstrType_CONSTR_UNIQUE, Conname: "uniq"}, []string{"a"}, "uniq"},
+		{"unnamed unique", &pg_query.Constraint{Contype: pg_query.ConstrType_CONSTR_UNIQUE}, []string{"a", "b"}, "users_a_b_key"},
+		{"unnamed primary key", &pg_query.Constraint{Contype: pg_query.ConstrType_CONSTR_PRIMARY}, []string{"id"}, "users_pkey"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			if got := GetIndexName("users", test.constraint, test.columns); got != test.expected {
+				t.Fatalf("GetIndexName(%v, %v) returned %q; expected %q", test.constraint, test.columns, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DiagnosticCode           = "REV-000"
+	DiagnosticCodeEmptyDown  = "REV-001"
+	DiagnosticCodeNotDropped = "REV-002"
+)
+
+const (
+	ObjectTable    = "table"
+	ObjectIndex    = "index"
+	ObjectColumn   = "column"
+	ObjectType     = "type"
+	ObjectDomain   = "domain"
+	ObjectFunction = "function"
+	ObjectSchema   = "schema"
+)
+
+var DropCodeToObject = map[pg_query.ObjectType]string{
+	pg_query.ObjectType_OBJECT_TABLE:     ObjectTable,
+	pg_query.ObjectType_OBJECT_INDEX:     ObjectIndex,
+	pg_query.ObjectType_OBJECT_TYPE:      ObjectType,
+	pg_query.ObjectType_OBJECT_DOMAIN:    ObjectDomain,
+	pg_query.ObjectType_OBJECT_FUNCTION:  ObjectFunction,
+	pg_query.ObjectType_OBJECT_PROCEDURE: ObjectFunction,
+	pg_query.ObjectType_OBJECT_ROUTINE:   ObjectFunction,
+}
+
+type CreatedObject struct {
+	Kind string
+	// the table a column or index belongs to
+	Table string
+	Name  string
+}
+
+func (o CreatedObject) String() string {
+	switch {
+	case o.Kind == ObjectColumn:
+		return fmt.Sprintf("column %q of table %q", o.Name, o.Table)
+	case o.Kind == ObjectIndex && o.Name == "":
+		return fmt.Sprintf("unnamed index on table %q", o.Table)
+	}
+	return fmt.Sprintf("%s %q", o.Kind, o.Name)
+}
+
+// Returns the objects a statement creates, named as written (ie: possibly schema qualified)
+func GetCreatedObjects(statement *pg_query.RawStmt) []CreatedObject {
+	switch {
+	case statement.Stmt.GetCreateStmt() != nil:
+		create := statement.Stmt.GetCreateStmt()
+		// temporary tables are dropped at the end of the session anyway
+		if create.GetRelation().GetRelpersistence() == "t" {
+			return nil
+		}
+		return []CreatedObject{{Kind: ObjectTable, Name: pgquery.GetRangeVarName(create.Relation)}}
+	case statement.Stmt.GetIndexStmt() != nil:
+		create := statement.Stmt.GetIndexStmt()
+		index := CreatedObject{Kind: ObjectIndex, Table: pgquery.GetRangeVarName(create.Relation)}
+		if create.Idxname != "" {
+			// an index is created in the schema of its table
+			index.Name = pgquery.GetRangeVarName(&pg_query.RangeVar{Schemaname: create.GetRelation().GetSchemaname(), Relname: create.Idxname})
+		}
+		return []CreatedObject{index}
+	case statement.Stmt.GetCreateEnumStmt() != nil:
+		return []CreatedObject{{Kind: ObjectType, Name: getQualifiedName(statement.Stmt.GetCreateEnumStmt().TypeName)}}
+	case statement.Stmt.GetCreateRangeStmt() != nil:
+		return []CreatedObject{{Kind: ObjectType, Name: getQualifiedName(statement.Stmt.GetCreateRangeStmt().TypeName)}}
+	case statement.Stmt.GetCompositeTypeStmt() != nil:
+		return []CreatedObject{{Kind: ObjectType, Name: pgquery.GetRangeVarName(statement.Stmt.GetCompositeTypeStmt().Typevar)}}
+	case statement.Stmt.GetCreateDomainStmt() != nil:
+		return []CreatedObject{{Kind: ObjectDomain, Name: getQualifiedName(statement.Stmt.GetCreateDomainStmt().Domainname)}}
+	case statement.Stmt.GetDefineStmt() != nil && statement.Stmt.GetDefineStmt().Kind == pg_query.ObjectType_OBJECT_TYPE:
+		return []CreatedObject{{Kind: ObjectType, Name: getQualifiedName(statement.Stmt.GetDefineStmt().Defnames)}}
+	case statement.Stmt.GetCreateFunctionStmt() != nil:
+		return []CreatedObject{{Kind: ObjectFunction, Name: getQualifiedName(statement.Stmt.GetCreateFunctionStmt().Funcname)}}
+	}
+
+	objects := []CreatedObject{}
+	if alter := statement.Stmt.GetAlterTableStmt(); alter != nil {
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			if alterCmd.GetSubtype() == pg_query.AlterTableType_AT_AddColumn {
+				objects = append(objects, CreatedObject{
+					Kind:  ObjectColumn,
+					Table: pgquery.GetRangeVarName(alter.Relation),
+					Name:  alterCmd.GetDef().GetColumnDef().GetColname(),
+				})
+			}
+		}
+	}
+	return objects
+}
+
+// Returns a possibly schema qualified name, eg: of a type or function
+func getQualifiedName(names []*pg_query.Node) string {
+	return strings.Join(pgquery.GetStringValues(names), ".")
+}
+
+// Returns the schema of a possibly schema qualified name, or "" if it is unqualified
+func getSchema(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// the names of objects dropped by a migration as written (ie: possibly schema qualified), keyed by object kind
+// columns are keyed by `table.column`
+type DroppedObjects map[string]map[string]bool
+
+func (d DroppedObjects) add(kind string, name string) {
+	if d[kind] == nil {
+		d[kind] = map[string]bool{}
+	}
+	d[kind][name] = true
+}
+
+func (d DroppedObjects) ApplyStatement(statement *pg_query.RawStmt) {
+	if drop := statement.Stmt.GetDropStmt(); drop != nil {
+		if kind, ok := DropCodeToObject[drop.RemoveType]; ok {
+			for _, object := range drop.Objects {
+				d.add(kind, pgquery.GetObjectName(object))
+			}
+		}
+		// CASCADE drops every object in the schema along with it
+		if drop.RemoveType == pg_query.ObjectType_OBJECT_SCHEMA && drop.Behavior == pg_query.DropBehavior_DROP_CASCADE {
+			for _, object := range drop.Objects {
+				d.add(ObjectSchema, pgquery.GetObjectName(object))
+			}
+		}
+	}
+	// CREATE OR REPLACE FUNCTION restores the function as it was before the up migration
+	if create := statement.Stmt.GetCreateFunctionStmt(); create != nil && create.Replace {
+		d.add(ObjectFunction, getQualifiedName(create.Funcname))
+	}
+	if alter := statement.Stmt.GetAlterTableStmt(); alter != nil {
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			if alterCmd.GetSubtype() == pg_query.AlterTableType_AT_DropColumn {
+				d.add(ObjectColumn, pgquery.GetRangeVarName(alter.Relation)+"."+alterCmd.Name)
+			}
+		}
+	}
+}
+
+// Reports whether an object is dropped, either directly or along with the table or schema it belongs to
+func (d DroppedObjects) Covers(object CreatedObject) bool {
+	schema := getSchema(object.Name)
+	if object.Kind == ObjectColumn || object.Kind == ObjectIndex {
+		schema = getSchema(object.Table)
+	}
+	if schema != "" && d[ObjectSchema][schema] {
+		return true
+	}
+	switch object.Kind {
+	case ObjectColumn:
+		return d[ObjectColumn][object.Table+"."+object.Name] || d[ObjectTable][object.Table]
+	case ObjectIndex:
+		return (object.Name != "" && d[ObjectIndex][object.Name]) || d[ObjectTable][object.Table]
+	}
+	return d[object.Kind][object.Name]
+}
+
+type IrreversibleMigrationAnalyzer struct{}
+
+func (a *IrreversibleMigrationAnalyzer) AnalyzePair(ctx context.Context, up string, upOptions map[string]string, down string, downOptions map[string]string) []types.Diagnostic {
+	diagnostics := []types.Diagnostic{}
+	parseTrees := []*pg_query.ParseResult{}
+	for _, migration := range []string{up, down} {
+		parseTree, err := pg_query.Parse(migration)
+		if err != nil {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   -1,
+				LinePosition: -1,
+				Code:         DiagnosticCode,
+				Level:        types.DiagnosticLevelFatal,
+				Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+			})
+		}
+		parseTrees = append(parseTrees, parseTree)
+	}
+	if len(diagnostics) != 0 {
+		return diagnostics
+	}
+	upParseTree, downParseTree := parseTrees[0], parseTrees[1]
+
+	// the padding standing in for the up migration parses to no statements at all
+	if len(downParseTree.Stmts) == 0 {
+		if len(upParseTree.Stmts) == 0 {
+			return nil
+		}
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCodeEmptyDown,
+			Level:        types.DiagnosticLevelWarning,
+			Text:         "Down migration contains no statements, so this migration can not be rolled back. Add statements undoing the up migration",
+		}}
+	}
+
+	dropped := DroppedObjects{}
+	for _, statement := range downParseTree.Stmts {
+		dropped.ApplyStatement(statement)
+	}
+
+	for _, statement := range upParseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(up, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(up, byteOffset)
+		for _, object := range GetCreatedObjects(statement) {
+			if dropped.Covers(object) {
+				continue
+			}
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         DiagnosticCodeNotDropped,
+				Level:        types.DiagnosticLevelWarning,
+				Text:         fmt.Sprintf("The up migration creates %s, but the down migration never drops it", object),
+			})
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - the down migration contains statements
+	// - and drops every table, index, column, type, domain and function the up migration creates
+	output := analysis.DoSimplePairAnalysis(
+		input,
+		&IrreversibleMigrationAnalyzer{},
+		"Errors occurred around migration(s) whose down migration does not undo the up migration",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
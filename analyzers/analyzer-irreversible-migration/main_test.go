@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyzePair(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"empty down migration",
+			[]analysistest.Migration{{Up: "CREATE TABLE a (id bigint);", Down: "-- nothing to see here"}},
+			[]string{"1 REV-001 WARNING -1:-1"},
+		},
+		{
+			"empty up and down migrations",
+			[]analysistest.Migration{{Up: "", Down: ""}},
+			[]string{},
+		},
+		{
+			"every created object dropped",
+			[]analysistest.Migration{{
+				Up:   "CREATE TABLE a (id bigint);\nCREATE INDEX a_id_idx ON a (id);\nALTER TABLE b ADD COLUMN c int;\nCREATE TYPE mood AS ENUM ('happy');\nCREATE FUNCTION f() RETURNS int AS 'SELECT 1' LANGUAGE sql;",
+				Down: "DROP FUNCTION f;\nDROP TYPE mood;\nALTER TABLE b DROP COLUMN c;\nDROP INDEX a_id_idx;\nDROP TABLE a;",
+			}},
+			[]string{},
+		},
+		{
+			"created objects not dropped",
+			[]analysistest.Migration{{
+				Up:   "CREATE TABLE a (id bigint);\nCREATE INDEX a_id_idx ON b (id);\nALTER TABLE b ADD COLUMN c int;",
+				Down: "DROP TABLE a;",
+			}},
+			[]string{"1 REV-002 WARNING 2:1", "1 REV-002 WARNING 3:1"},
+		},
+		{
+			"index and column dropped along with their table",
+			[]analysistest.Migration{{
+				Up:   "CREATE TABLE a (id bigint);\nCREATE INDEX ON a (id);\nALTER TABLE a ADD COLUMN c int;",
+				Down: "DROP TABLE a;",
+			}},
+			[]string{},
+		},
+		{
+			"object of the same name dropped in another schema",
+			[]analysistest.Migration{{Up: "CREATE TABLE app.a (id bigint);", Down: "DROP TABLE a;"}},
+			[]string{"1 REV-002 WARNING 1:1"},
+		},
+		{
+			"schema dropped with CASCADE",
+			[]analysistest.Migration{{
+				Up:   "CREATE TABLE app.a (id bigint);\nCREATE INDEX ON app.a (id);\nCREATE TYPE app.mood AS ENUM ('happy');",
+				Down: "DROP SCHEMA app CASCADE;",
+			}},
+			[]string{},
+		},
+		{
+			"schema dropped without CASCADE",
+			[]analysistest.Migration{{Up: "CREATE TABLE app.a (id bigint);", Down: "DROP SCHEMA app;"}},
+			[]string{"1 REV-002 WARNING 1:1"},
+		},
+		{
+			"function replaced by the down migration",
+			[]analysistest.Migration{{
+				Up:   "CREATE OR REPLACE FUNCTION f() RETURNS int AS 'SELECT 2' LANGUAGE sql;",
+				Down: "CREATE OR REPLACE FUNCTION f() RETURNS int AS 'SELECT 1' LANGUAGE sql;",
+			}},
+			[]string{},
+		},
+		{
+			"temporary table",
+			[]analysistest.Migration{{Up: "CREATE TEMP TABLE a (id bigint);\nDROP TABLE b;", Down: "CREATE TABLE b (id bigint);"}},
+			[]string{},
+		},
+		{
+			"unparseable up and down migrations",
+			[]analysistest.Migration{{Up: "CREATE TABLE;", Down: "DROP TABLE;"}},
+			[]string{"1 REV-000 FATAL -1:-1", "1 REV-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimplePairAnalysis(analysistest.Input(nil, test.migrations...), &IrreversibleMigrationAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("AnalyzePair(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DiagnosticCode                  = "MNT-000"
+	DiagnosticCodeReindex           = "MNT-001"
+	DiagnosticCodeCluster           = "MNT-002"
+	DiagnosticCodeVacuumFull        = "MNT-003"
+	DiagnosticCodeWithinTransaction = "MNT-004"
+)
+
+var ReindexKindToObject = map[pg_query.ReindexObjectType]string{
+	pg_query.ReindexObjectType_REINDEX_OBJECT_INDEX:    "INDEX",
+	pg_query.ReindexObjectType_REINDEX_OBJECT_TABLE:    "TABLE",
+	pg_query.ReindexObjectType_REINDEX_OBJECT_SCHEMA:   "SCHEMA",
+	pg_query.ReindexObjectType_REINDEX_OBJECT_SYSTEM:   "SYSTEM",
+	pg_query.ReindexObjectType_REINDEX_OBJECT_DATABASE: "DATABASE",
+}
+
+// Returns a short description of a REINDEX statement, eg: `REINDEX TABLE CONCURRENTLY "users"`
+func describeReindex(reindex *pg_query.ReindexStmt, concurrent bool) string {
+	name := reindex.Name
+	if reindex.Relation != nil {
+		name = pgquery.GetRangeVarName(reindex.Relation)
+	}
+	description := fmt.Sprintf("REINDEX %s", ReindexKindToObject[reindex.Kind])
+	if concurrent {
+		description += " CONCURRENTLY"
+	}
+	if name != "" {
+		description += fmt.Sprintf(" %q", name)
+	}
+	return description
+}
+
+// Returns the names of the tables a VACUUM or CLUSTER statement processes, or "every table" if none are named
+func describeTables(relations []*pg_query.RangeVar) string {
+	names := []string{}
+	for _, relation := range relations {
+		names = append(names, fmt.Sprintf("%q", pgquery.GetRangeVarName(relation)))
+	}
+	if len(names) == 0 {
+		return "every table"
+	}
+	if len(names) == 1 {
+		return "table " + names[0]
+	}
+	return "tables " + strings.Join(names, ", ")
+}
+
+type MaintenanceCommandsAnalyzer struct{}
+
+func (a *MaintenanceCommandsAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// dbmate runs every migration in a transaction block unless `transaction:false` is set
+	inTransaction := options["transaction"] != "false"
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		report := func(code string, level string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        level,
+				Text:         text,
+			})
+		}
+		reportWithinTransaction := func(description string) {
+			report(
+				DiagnosticCodeWithinTransaction,
+				types.DiagnosticLevelFatal,
+				fmt.Sprintf("%s statement is happening within a transaction block! This is prohibited, set `transaction:false` on the migration", description),
+			)
+		}
+
+		if reindex := statement.Stmt.GetReindexStmt(); reindex != nil {
+			concurrent := pgquery.IsOptionEnabled(reindex.Params, "concurrently")
+			description := describeReindex(reindex, concurrent)
+			if !concurrent {
+				report(
+					DiagnosticCodeReindex,
+					types.DiagnosticLevelWarning,
+					fmt.Sprintf("%s statement missing CONCURRENTLY option, it blocks all writes (and reads using the index) until it finishes", description),
+				)
+			}
+			// REINDEX SYSTEM and REINDEX DATABASE can never run in a transaction block
+			if inTransaction && (concurrent ||
+				reindex.Kind == pg_query.ReindexObjectType_REINDEX_OBJECT_SYSTEM ||
+				reindex.Kind == pg_query.ReindexObjectType_REINDEX_OBJECT_DATABASE) {
+				reportWithinTransaction(description)
+			}
+		}
+
+		if cluster := statement.Stmt.GetClusterStmt(); cluster != nil {
+			relations := []*pg_query.RangeVar{}
+			if cluster.Relation != nil {
+				relations = append(relations, cluster.Relation)
+			}
+			report(
+				DiagnosticCodeCluster,
+				types.DiagnosticLevelFatal,
+				fmt.Sprintf("CLUSTER rewrites %s under an ACCESS EXCLUSIVE lock, blocking all reads and writes until it finishes. Run it (or eg: pg_repack) outside of a deploy-time migration", describeTables(relations)),
+			)
+			// CLUSTER without a table name can not run in a transaction block
+			if inTransaction && cluster.Relation == nil {
+				reportWithinTransaction("CLUSTER")
+			}
+		}
+
+		// ANALYZE is parsed as a VacuumStmt too, but is allowed in a transaction block
+		if vacuum := statement.Stmt.GetVacuumStmt(); vacuum != nil && vacuum.IsVacuumcmd {
+			relations := []*pg_query.RangeVar{}
+			for _, rel := range vacuum.Rels {
+				relations = append(relations, rel.GetVacuumRelation().GetRelation())
+			}
+			description := "VACUUM"
+			if pgquery.IsOptionEnabled(vacuum.Options, "full") {
+				description = "VACUUM FULL"
+				report(
+					DiagnosticCodeVacuumFull,
+					types.DiagnosticLevelFatal,
+					fmt.Sprintf("VACUUM FULL rewrites %s under an ACCESS EXCLUSIVE lock, blocking all reads and writes until it finishes. Run it (or eg: pg_repack) outside of a deploy-time migration", describeTables(relations)),
+				)
+			}
+			if inTransaction {
+				reportWithinTransaction(description)
+			}
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any REINDEX operation has a CONCURRENTLY keyword attached to it
+	// - no CLUSTER or VACUUM FULL operation is performed
+	// - no REINDEX CONCURRENTLY or VACUUM operation is performed inside a TRANSACTION block (this is illegal)
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&MaintenanceCommandsAnalyzer{},
+		"Errors occurred around REINDEX, CLUSTER or VACUUM statement(s) unsuited to a deploy-time migration",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
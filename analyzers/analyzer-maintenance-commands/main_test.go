@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"REINDEX without CONCURRENTLY",
+			[]analysistest.Migration{{Up: "REINDEX INDEX users_email_idx;"}},
+			[]string{"1 MNT-001 WARNING 1:1"},
+		},
+		{
+			"REINDEX CONCURRENTLY within a transaction",
+			[]analysistest.Migration{{Up: "REINDEX TABLE CONCURRENTLY users;"}},
+			[]string{"1 MNT-004 FATAL 1:1"},
+		},
+		{
+			"REINDEX CONCURRENTLY outside of a transaction",
+			[]analysistest.Migration{{Up: "REINDEX TABLE CONCURRENTLY users;", NoTransaction: true}},
+			[]string{},
+		},
+		{
+			"REINDEX DATABASE within a transaction",
+			[]analysistest.Migration{{Up: "REINDEX DATABASE app;"}},
+			[]string{"1 MNT-001 WARNING 1:1", "1 MNT-004 FATAL 1:1"},
+		},
+		{
+			"CLUSTER of a table",
+			[]analysistest.Migration{{Up: "CLUSTER users USING users_pkey;"}},
+			[]string{"1 MNT-002 FATAL 1:1"},
+		},
+		{
+			"CLUSTER of every table within a transaction",
+			[]analysistest.Migration{{Up: "CLUSTER;"}},
+			[]string{"1 MNT-002 FATAL 1:1", "1 MNT-004 FATAL 1:1"},
+		},
+		{
+			"VACUUM FULL",
+			[]analysistest.Migration{{Up: "VACUUM FULL users;", NoTransaction: true}},
+			[]string{"1 MNT-003 FATAL 1:1"},
+		},
+		{
+			"VACUUM within a transaction",
+			[]analysistest.Migration{{Up: "SELECT 1;\nVACUUM users;"}},
+			[]string{"1 MNT-004 FATAL 2:1"},
+		},
+		{
+			"VACUUM outside of a transaction",
+			[]analysistest.Migration{{Up: "VACUUM (ANALYZE) users;", NoTransaction: true}},
+			[]string{},
+		},
+		{
+			"ANALYZE within a transaction",
+			[]analysistest.Migration{{Up: "ANALYZE users;"}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "REINDEX;"}},
+			[]string{"1 MNT-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(nil, test.migrations...), &MaintenanceCommandsAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	PartitionedTablesKey             = "partitioned_tables"
+	DiagnosticCode                   = "PRT-000"
+	DiagnosticCodeDetach             = "PRT-001"
+	DiagnosticCodeDetachInTx         = "PRT-002"
+	DiagnosticCodeAttachWithoutCheck = "PRT-003"
+	DiagnosticCodeIndexOnParent      = "PRT-004"
+)
+
+type CheckConstraint struct {
+	Name      string
+	Expr      *pg_query.Node
+	Validated bool
+}
+
+// Returns the columns and constants an expression refers to, eg: `at >= DATE '2024-01-01'` refers to `at` and `2024-01-01`
+func getColumnsAndConstants(nodes ...*pg_query.Node) (map[string]bool, map[string]bool) {
+	columns, constants := map[string]bool{}, map[string]bool{}
+	for _, node := range nodes {
+		pgquery.Walk(node, func(node *pg_query.Node) bool {
+			if columnRef := node.GetColumnRef(); columnRef != nil {
+				columns[pgquery.GetUnqualifiedName(columnRef.Fields)] = true
+			}
+			if constant := node.GetAConst(); constant != nil {
+				switch {
+				case constant.GetSval() != nil:
+					constants[constant.GetSval().Sval] = true
+				case constant.GetIval() != nil:
+					constants[fmt.Sprint(constant.GetIval().Ival)] = true
+				case constant.GetFval() != nil:
+					constants[constant.GetFval().Fval] = true
+				case constant.GetBoolval() != nil:
+					constants[fmt.Sprint(constant.GetBoolval().Boolval)] = true
+				}
+			}
+			return true
+		})
+	}
+	return columns, constants
+}
+
+// Reports whether a CHECK constraint looks like it implies a partition bound,
+// ie: it refers to every partition key column and every constant of the bound.
+// postgres does the actual proof, this only catches constraints that clearly can not match
+func MatchesBound(check CheckConstraint, keys []string, bound *pg_query.PartitionBoundSpec) bool {
+	checkColumns, checkConstants := getColumnsAndConstants(check.Expr)
+	for _, key := range keys {
+		if !checkColumns[key] {
+			return false
+		}
+	}
+	datums := append(append(append([]*pg_query.Node{}, bound.Listdatums...), bound.Lowerdatums...), bound.Upperdatums...)
+	_, boundConstants := getColumnsAndConstants(datums...)
+	for constant := range boundConstants {
+		if !checkConstants[constant] {
+			return false
+		}
+	}
+	return true
+}
+
+// the CHECK constraints of each table, keyed by (possibly schema qualified) table name
+type Checks map[string][]CheckConstraint
+
+func (c Checks) Clone() Checks {
+	clone := Checks{}
+	for table, checks := range c {
+		clone[table] = append([]CheckConstraint{}, checks...)
+	}
+	return clone
+}
+
+func (c Checks) Apply(statement *pg_query.RawStmt) {
+	if create := statement.Stmt.GetCreateStmt(); create != nil {
+		table := pgquery.GetRangeVarName(create.Relation)
+		for _, element := range create.TableElts {
+			constraints := append([]*pg_query.Node{element}, element.GetColumnDef().GetConstraints()...)
+			for _, constraint := range constraints {
+				if constraint.GetConstraint().GetContype() == pg_query.ConstrType_CONSTR_CHECK {
+					c[table] = append(c[table], CheckConstraint{
+						Name:      constraint.GetConstraint().Conname,
+						Expr:      constraint.GetConstraint().RawExpr,
+						Validated: true,
+					})
+				}
+			}
+		}
+	}
+	if drop := statement.Stmt.GetDropStmt(); drop != nil && drop.RemoveType == pg_query.ObjectType_OBJECT_TABLE {
+		for _, object := range drop.Objects {
+			delete(c, pgquery.GetObjectName(object))
+		}
+	}
+	alter := statement.Stmt.GetAlterTableStmt()
+	if alter == nil || alter.Objtype != pg_query.ObjectType_OBJECT_TABLE {
+		return
+	}
+	table := pgquery.GetRangeVarName(alter.Relation)
+	for _, cmd := range alter.Cmds {
+		alterCmd := cmd.GetAlterTableCmd()
+		switch alterCmd.GetSubtype() {
+		case pg_query.AlterTableType_AT_AddConstraint:
+			constraint := alterCmd.GetDef().GetConstraint()
+			if constraint.GetContype() == pg_query.ConstrType_CONSTR_CHECK {
+				c[table] = append(c[table], CheckConstraint{
+					Name:      constraint.Conname,
+					Expr:      constraint.RawExpr,
+					Validated: !constraint.SkipValidation,
+				})
+			}
+		case pg_query.AlterTableType_AT_ValidateConstraint:
+			for i := range c[table] {
+				if c[table][i].Name == alterCmd.Name {
+					c[table][i].Validated = true
+				}
+			}
+		case pg_query.AlterTableType_AT_DropConstraint:
+			checks := []CheckConstraint{}
+			for _, check := range c[table] {
+				if check.Name != alterCmd.Name {
+					checks = append(checks, check)
+				}
+			}
+			c[table] = checks
+		}
+	}
+}
+
+// Returns the CREATE INDEX statement for only the partitioned table itself, eg: `CREATE INDEX ... ON ONLY measurements (at)`
+func getIndexOnOnlyStatement(create *pg_query.IndexStmt) string {
+	onOnly := proto.Clone(create).(*pg_query.IndexStmt)
+	onOnly.Relation.Inh = false
+	onOnly.Concurrent = false
+	statement, err := pg_query.Deparse(&pg_query.ParseResult{
+		Stmts: []*pg_query.RawStmt{{Stmt: &pg_query.Node{Node: &pg_query.Node_IndexStmt{IndexStmt: onOnly}}}},
+	})
+	if err != nil {
+		return fmt.Sprintf("CREATE INDEX ... ON ONLY %s ...", pgquery.GetRangeVarName(create.Relation))
+	}
+	return statement
+}
+
+type PartitioningAnalyzer struct {
+	// the partition key columns of the partitioned tables created by all the up migrations analyzed so far,
+	// keyed by (possibly schema qualified) table name. a partitioned table with unknown keys has no columns
+	partitionKeys map[string][]string
+	// the CHECK constraints created by all the up migrations analyzed so far
+	checks Checks
+}
+
+func (a *PartitioningAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// only up migrations build up the schema across migrations,
+	// a down migration only sees its own changes on top of its up migration
+	partitionKeys, checks := a.partitionKeys, a.checks
+	if analysis.GetDirection(ctx) != analysis.DirectionUp {
+		partitionKeys, checks = map[string][]string{}, a.checks.Clone()
+		for table, keys := range a.partitionKeys {
+			partitionKeys[table] = keys
+		}
+	}
+	// partitioned tables created outside of the analyzed migrations, named as the migrations name them (eg: `app.events`)
+	if tables, ok := analysis.GetConfigList(ctx, PartitionedTablesKey); ok {
+		for _, table := range tables {
+			if _, ok := partitionKeys[table]; !ok {
+				partitionKeys[table] = nil
+			}
+		}
+	}
+
+	// dbmate runs every migration in a transaction block unless `transaction:false` is set
+	inTransaction := options["transaction"] != "false"
+
+	// tables created within this same migration are empty, so scanning or locking them is harmless
+	createdTables := map[string]bool{}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		report := func(code string, level string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        level,
+				Text:         text,
+			})
+		}
+
+		if create := statement.Stmt.GetCreateStmt(); create != nil {
+			createdTables[pgquery.GetRangeVarName(create.Relation)] = true
+			if create.Partspec != nil {
+				keys := []string{}
+				for _, param := range create.Partspec.PartParams {
+					// expression keys can not be matched to columns
+					if name := param.GetPartitionElem().GetName(); name != "" {
+						keys = append(keys, name)
+					}
+				}
+				partitionKeys[pgquery.GetRangeVarName(create.Relation)] = keys
+			}
+		}
+
+		if create := statement.Stmt.GetIndexStmt(); create != nil {
+			table := pgquery.GetRangeVarName(create.Relation)
+			if _, partitioned := partitionKeys[table]; partitioned && create.GetRelation().GetInh() && !createdTables[table] {
+				level := types.DiagnosticLevelWarning
+				text := fmt.Sprintf(
+					"CREATE INDEX on partitioned table %q builds the index on every partition at once, blocking writes to all of them until it is done (and can not be CONCURRENTLY)",
+					pgquery.GetRangeVarName(create.Relation),
+				)
+				if create.Concurrent {
+					level = types.DiagnosticLevelFatal
+					text = fmt.Sprintf(
+						"CREATE INDEX CONCURRENTLY on partitioned table %q fails, as indexes on partitioned tables can not be built concurrently",
+						pgquery.GetRangeVarName(create.Relation),
+					)
+				}
+				report(
+					DiagnosticCodeIndexOnParent,
+					level,
+					fmt.Sprintf(
+						"%s. Instead, run `%s`, then for each partition CREATE INDEX CONCURRENTLY on the partition and ALTER INDEX ... ATTACH PARTITION it to the new index",
+						text,
+						getIndexOnOnlyStatement(create),
+					),
+				)
+			}
+		}
+
+		if alter := statement.Stmt.GetAlterTableStmt(); alter != nil && alter.Objtype == pg_query.ObjectType_OBJECT_TABLE {
+			parent := pgquery.GetRangeVarName(alter.Relation)
+			for _, cmd := range alter.Cmds {
+				alterCmd := cmd.GetAlterTableCmd()
+				partitionCmd := alterCmd.GetDef().GetPartitionCmd()
+				if partitionCmd == nil {
+					continue
+				}
+				if _, ok := partitionKeys[parent]; !ok {
+					partitionKeys[parent] = nil
+				}
+				partition := pgquery.GetRangeVarName(partitionCmd.Name)
+				if createdTables[partition] {
+					continue
+				}
+
+				switch alterCmd.GetSubtype() {
+				case pg_query.AlterTableType_AT_DetachPartition:
+					if !partitionCmd.Concurrent {
+						report(
+							DiagnosticCodeDetach,
+							types.DiagnosticLevelWarning,
+							fmt.Sprintf(
+								"DETACH PARTITION %q from table %q takes an ACCESS EXCLUSIVE lock on the partitioned table, blocking all reads and writes to every partition. Use `DETACH PARTITION ... CONCURRENTLY` in a migration with `transaction:false` instead",
+								pgquery.GetRangeVarName(partitionCmd.Name),
+								pgquery.GetRangeVarName(alter.Relation),
+							),
+						)
+					} else if inTransaction {
+						report(
+							DiagnosticCodeDetachInTx,
+							types.DiagnosticLevelFatal,
+							fmt.Sprintf(
+								"DETACH PARTITION %q CONCURRENTLY statement is happening within a transaction block! This is prohibited, set `transaction:false` on the migration",
+								pgquery.GetRangeVarName(partitionCmd.Name),
+							),
+						)
+					}
+				case pg_query.AlterTableType_AT_AttachPartition:
+					bound := partitionCmd.GetBound()
+					// default and hash partition bounds can not practically be implied by a CHECK constraint
+					if bound == nil || bound.IsDefault || bound.Strategy == "h" {
+						continue
+					}
+					matched := false
+					for _, check := range checks[partition] {
+						if check.Validated && MatchesBound(check, partitionKeys[parent], bound) {
+							matched = true
+						}
+					}
+					if !matched {
+						report(
+							DiagnosticCodeAttachWithoutCheck,
+							types.DiagnosticLevelWarning,
+							fmt.Sprintf(
+								"ATTACH PARTITION %q to table %q scans the whole partition to check its rows fit the partition bound, while holding an ACCESS EXCLUSIVE lock on it. Before attaching, add a CHECK constraint matching the partition bound with NOT VALID and VALIDATE it, so postgres can skip the scan",
+								pgquery.GetRangeVarName(partitionCmd.Name),
+								pgquery.GetRangeVarName(alter.Relation),
+							),
+						)
+					}
+				}
+			}
+		}
+
+		checks.Apply(statement)
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that across all migrations:
+	// - any DETACH PARTITION operation is CONCURRENTLY, outside of a TRANSACTION block
+	// - any ATTACH PARTITION operation is preceded by a validated CHECK constraint matching the partition bound
+	// - no CREATE INDEX operation is performed on a whole partitioned table
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&PartitioningAnalyzer{
+			partitionKeys: map[string][]string{},
+			checks:        Checks{},
+		},
+		"Errors occurred around partitioning statement(s)",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+const createEvents = "CREATE TABLE events (id bigint, created_at date) PARTITION BY RANGE (created_at);\nCREATE TABLE events_2024 (id bigint, created_at date);"
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"DETACH PARTITION without CONCURRENTLY",
+			nil,
+			[]analysistest.Migration{{Up: createEvents}, {Up: "ALTER TABLE events DETACH PARTITION events_2024;"}},
+			[]string{"2 PRT-001 WARNING 1:1"},
+		},
+		{
+			"DETACH PARTITION CONCURRENTLY within a transaction",
+			nil,
+			[]analysistest.Migration{{Up: createEvents}, {Up: "ALTER TABLE events DETACH PARTITION events_2024 CONCURRENTLY;"}},
+			[]string{"2 PRT-002 FATAL 1:1"},
+		},
+		{
+			"DETACH PARTITION CONCURRENTLY outside of a transaction",
+			nil,
+			[]analysistest.Migration{{Up: createEvents}, {Up: "ALTER TABLE events DETACH PARTITION events_2024 CONCURRENTLY;", NoTransaction: true}},
+			[]string{},
+		},
+		{
+			"ATTACH PARTITION without a CHECK constraint",
+			nil,
+			[]analysistest.Migration{{Up: createEvents}, {Up: "ALTER TABLE events ATTACH PARTITION events_2024 FOR VALUES FROM ('2024-01-01') TO ('2025-01-01');"}},
+			[]string{"2 PRT-003 WARNING 1:1"},
+		},
+		{
+			"ATTACH PARTITION after a validated CHECK constraint matching the bound",
+			nil,
+			[]analysistest.Migration{
+				{Up: createEvents},
+				{Up: "ALTER TABLE events_2024 ADD CONSTRAINT bound CHECK (created_at >= '2024-01-01' AND created_at < '2025-01-01') NOT VALID;"},
+				{Up: "ALTER TABLE events_2024 VALIDATE CONSTRAINT bound;\nALTER TABLE events ATTACH PARTITION events_2024 FOR VALUES FROM ('2024-01-01') TO ('2025-01-01');"},
+			},
+			[]string{},
+		},
+		{
+			"ATTACH PARTITION after a CHECK constraint that is not validated",
+			nil,
+			[]analysistest.Migration{
+				{Up: createEvents},
+				{Up: "ALTER TABLE events_2024 ADD CONSTRAINT bound CHECK (created_at >= '2024-01-01' AND created_at < '2025-01-01') NOT VALID;\nALTER TABLE events ATTACH PARTITION events_2024 FOR VALUES FROM ('2024-01-01') TO ('2025-01-01');"},
+			},
+			[]string{"2 PRT-003 WARNING 2:1"},
+		},
+		{
+			"ATTACH PARTITION after a CHECK constraint not matching the bound",
+			nil,
+			[]analysistest.Migration{
+				{Up: createEvents},
+				{Up: "ALTER TABLE events_2024 ADD CONSTRAINT bound CHECK (created_at >= '2023-01-01' AND created_at < '2025-01-01');\nALTER TABLE events ATTACH PARTITION events_2024 FOR VALUES FROM ('2024-01-01') TO ('2025-01-01');"},
+			},
+			[]string{"2 PRT-003 WARNING 2:1"},
+		},
+		{
+			"ATTACH PARTITION of a table created in the same migration",
+			nil,
+			[]analysistest.Migration{{Up: createEvents + "\nALTER TABLE events ATTACH PARTITION events_2024 FOR VALUES FROM ('2024-01-01') TO ('2025-01-01');"}},
+			[]string{},
+		},
+		{
+			"CREATE INDEX on a partitioned table",
+			nil,
+			[]analysistest.Migration{{Up: createEvents}, {Up: "CREATE INDEX events_id_idx ON events (id);\nCREATE INDEX events_2024_id_idx ON events_2024 (id);"}},
+			[]string{"2 PRT-004 WARNING 1:1"},
+		},
+		{
+			"CREATE INDEX CONCURRENTLY on a configured partitioned table",
+			map[string]string{PartitionedTablesKey: "app.events"},
+			[]analysistest.Migration{{Up: "CREATE INDEX CONCURRENTLY events_id_idx ON app.events (id);\nCREATE INDEX CONCURRENTLY events_id_idx ON events (id);", NoTransaction: true}},
+			[]string{"1 PRT-004 FATAL 1:1"},
+		},
+		{
+			"CREATE INDEX ON ONLY a partitioned table",
+			nil,
+			[]analysistest.Migration{{Up: createEvents}, {Up: "CREATE INDEX events_id_idx ON ONLY events (id);"}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE events DETACH PARTITION;"}},
+			[]string{"1 PRT-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(
+				analysistest.Input(test.config, test.migrations...),
+				&PartitioningAnalyzer{partitionKeys: map[string][]string{}, checks: Checks{}},
+				"",
+				[]string{},
+			)
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
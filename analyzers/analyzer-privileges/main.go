@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	SecurityTeamKey                = "privileges_security_team"
+	DiagnosticCode                 = "PRV-000"
+	DiagnosticCodeGrant            = "PRV-001"
+	DiagnosticCodeGrantToPublic    = "PRV-002"
+	DiagnosticCodeGrantRole        = "PRV-003"
+	DiagnosticCodeChangeOwner      = "PRV-004"
+	DiagnosticCodeDefaultPrivilege = "PRV-005"
+	DiagnosticCodeRole             = "PRV-006"
+)
+
+// Returns a role as it is written, eg: `app`, `PUBLIC` or `CURRENT_USER`
+func DescribeRole(role *pg_query.RoleSpec) string {
+	if role.GetRoletype() == pg_query.RoleSpecType_ROLESPEC_CSTRING {
+		return role.Rolename
+	}
+	return strings.TrimPrefix(role.GetRoletype().String(), "ROLESPEC_")
+}
+
+// Returns the roles as they are written, along with whether any of them is PUBLIC
+func describeRoles(roles []*pg_query.Node) (string, bool) {
+	names := []string{}
+	public := false
+	for _, role := range roles {
+		if role.GetRoleSpec().GetRoletype() == pg_query.RoleSpecType_ROLESPEC_PUBLIC {
+			public = true
+		}
+		names = append(names, DescribeRole(role.GetRoleSpec()))
+	}
+	return strings.Join(names, ", "), public
+}
+
+// Returns the privileges as they are written, eg: `SELECT, UPDATE (a, b)`
+// no privileges at all means ALL PRIVILEGES
+func DescribePrivileges(privileges []*pg_query.Node) string {
+	if len(privileges) == 0 {
+		return "ALL PRIVILEGES"
+	}
+	names := []string{}
+	for _, privilege := range privileges {
+		name := strings.ToUpper(privilege.GetAccessPriv().GetPrivName())
+		if columns := pgquery.GetStringValues(privilege.GetAccessPriv().GetCols()); len(columns) > 0 {
+			name += " (" + strings.Join(columns, ", ") + ")"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Returns the objects a GRANT or REVOKE applies to, as they are written
+// eg: `TABLE users, orders` or `ALL FUNCTIONS IN SCHEMA app`
+func describeGrantObjects(grant *pg_query.GrantStmt) string {
+	names := []string{}
+	for _, object := range grant.Objects {
+		names = append(names, pgquery.GetObjectName(object))
+	}
+	if grant.Targtype == pg_query.GrantTargetType_ACL_TARGET_ALL_IN_SCHEMA {
+		return fmt.Sprintf("ALL %sS IN SCHEMA %s", pgquery.GetObjectTypeName(grant.Objtype), strings.Join(names, ", "))
+	}
+	return pgquery.GetObjectTypeName(grant.Objtype) + " " + strings.Join(names, ", ")
+}
+
+type PrivilegesAnalyzer struct{}
+
+func (a *PrivilegesAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		report := func(code string, level string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        level,
+				Text:         text,
+			})
+		}
+
+		// granting to PUBLIC grants to every role in the database, including ones created later
+		reportGrant := func(grant *pg_query.GrantStmt) {
+			grantees, public := describeRoles(grant.Grantees)
+			switch {
+			case grant.IsGrant && public:
+				report(
+					DiagnosticCodeGrantToPublic,
+					types.DiagnosticLevelFatal,
+					fmt.Sprintf(
+						"GRANT %s ON %s TO %s gives every role in the database (including roles created later) these privileges. Grant them to a specific role instead",
+						DescribePrivileges(grant.Privileges),
+						describeGrantObjects(grant),
+						grantees,
+					),
+				)
+			case grant.IsGrant:
+				report(
+					DiagnosticCodeGrant,
+					types.DiagnosticLevelWarning,
+					fmt.Sprintf(
+						"GRANT %s ON %s TO %s changes database permissions, and must be reviewed by the security team",
+						DescribePrivileges(grant.Privileges),
+						describeGrantObjects(grant),
+						grantees,
+					),
+				)
+			default:
+				report(
+					DiagnosticCodeGrant,
+					types.DiagnosticLevelWarning,
+					fmt.Sprintf(
+						"REVOKE %s ON %s FROM %s changes database permissions, and must be reviewed by the security team",
+						DescribePrivileges(grant.Privileges),
+						describeGrantObjects(grant),
+						grantees,
+					),
+				)
+			}
+		}
+
+		switch {
+		case statement.Stmt.GetGrantStmt() != nil:
+			reportGrant(statement.Stmt.GetGrantStmt())
+		case statement.Stmt.GetAlterDefaultPrivilegesStmt() != nil:
+			grant := statement.Stmt.GetAlterDefaultPrivilegesStmt().Action
+			grantees, public := describeRoles(grant.Grantees)
+			verb, preposition := "REVOKE", "FROM"
+			if grant.IsGrant {
+				verb, preposition = "GRANT", "TO"
+			}
+			level := types.DiagnosticLevelWarning
+			if grant.IsGrant && public {
+				level = types.DiagnosticLevelFatal
+			}
+			report(
+				DiagnosticCodeDefaultPrivilege,
+				level,
+				fmt.Sprintf(
+					"ALTER DEFAULT PRIVILEGES %s %s ON %sS %s %s changes the permissions of every object created from now on, and must be reviewed by the security team",
+					verb,
+					DescribePrivileges(grant.Privileges),
+					pgquery.GetObjectTypeName(grant.Objtype),
+					preposition,
+					grantees,
+				),
+			)
+		case statement.Stmt.GetGrantRoleStmt() != nil:
+			grant := statement.Stmt.GetGrantRoleStmt()
+			grantees, _ := describeRoles(grant.GranteeRoles)
+			// granted roles are names, not privileges to upper case
+			roles := []string{}
+			for _, role := range grant.GrantedRoles {
+				roles = append(roles, role.GetAccessPriv().GetPrivName())
+			}
+			text := fmt.Sprintf("GRANT role %s TO %s", strings.Join(roles, ", "), grantees)
+			if !grant.IsGrant {
+				text = fmt.Sprintf("REVOKE role %s FROM %s", strings.Join(roles, ", "), grantees)
+			}
+			report(
+				DiagnosticCodeGrantRole,
+				types.DiagnosticLevelWarning,
+				text+" changes role membership (and every privilege that comes with it), and must be reviewed by the security team",
+			)
+		case statement.Stmt.GetAlterOwnerStmt() != nil:
+			alter := statement.Stmt.GetAlterOwnerStmt()
+			name := pgquery.GetObjectName(alter.Object)
+			if alter.Relation != nil {
+				name = pgquery.GetRangeVarName(alter.Relation)
+			}
+			report(
+				DiagnosticCodeChangeOwner,
+				types.DiagnosticLevelWarning,
+				fmt.Sprintf(
+					"ALTER %s %s OWNER TO %s gives the new owner every privilege on it, and must be reviewed by the security team",
+					pgquery.GetObjectTypeName(alter.ObjectType),
+					name,
+					DescribeRole(alter.Newowner),
+				),
+			)
+		case statement.Stmt.GetAlterTableStmt() != nil:
+			alter := statement.Stmt.GetAlterTableStmt()
+			for _, cmd := range alter.Cmds {
+				alterCmd := cmd.GetAlterTableCmd()
+				if alterCmd.GetSubtype() != pg_query.AlterTableType_AT_ChangeOwner {
+					continue
+				}
+				report(
+					DiagnosticCodeChangeOwner,
+					types.DiagnosticLevelWarning,
+					fmt.Sprintf(
+						"ALTER %s %s OWNER TO %s gives the new owner every privilege on it, and must be reviewed by the security team",
+						pgquery.GetObjectTypeName(alter.Objtype),
+						pgquery.GetRangeVarName(alter.Relation),
+						DescribeRole(alterCmd.Newowner),
+					),
+				)
+			}
+		case statement.Stmt.GetCreateRoleStmt() != nil:
+			create := statement.Stmt.GetCreateRoleStmt()
+			text := fmt.Sprintf("CREATE %s %q adds a new database role", strings.TrimPrefix(create.StmtType.String(), "ROLESTMT_"), create.Role)
+			for _, option := range create.Options {
+				if option.GetDefElem().GetDefname() == "password" {
+					text += " with its password committed to the repository,"
+				}
+			}
+			report(DiagnosticCodeRole, types.DiagnosticLevelWarning, text+" and must be reviewed by the security team")
+		case statement.Stmt.GetAlterRoleStmt() != nil:
+			report(
+				DiagnosticCodeRole,
+				types.DiagnosticLevelWarning,
+				fmt.Sprintf(
+					"ALTER ROLE %s changes a database role's attributes, and must be reviewed by the security team",
+					DescribeRole(statement.Stmt.GetAlterRoleStmt().Role),
+				),
+			)
+		case statement.Stmt.GetAlterRoleSetStmt() != nil:
+			report(
+				DiagnosticCodeRole,
+				types.DiagnosticLevelWarning,
+				fmt.Sprintf(
+					"ALTER ROLE %s SET changes a database role's session defaults, and must be reviewed by the security team",
+					DescribeRole(statement.Stmt.GetAlterRoleSetStmt().Role),
+				),
+			)
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any GRANT, REVOKE, ALTER DEFAULT PRIVILEGES, OWNER TO, CREATE ROLE or ALTER ROLE operation
+	// - is reviewed by the security team, and nothing is granted to PUBLIC
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&PrivilegesAnalyzer{},
+		"Errors occurred around privilege and ownership change statement(s)",
+		[]string{types.RequestReviewersAction},
+	)
+
+	// request the security team as reviewers, instead of the usual `github_reviewers`
+	ctx := analysis.WithConfig(context.Background(), input.Metadata.Config)
+	if team, ok := analysis.GetConfigValue(ctx, SecurityTeamKey); ok {
+		for i, report := range output.Reports {
+			config := map[string]string{}
+			for key, value := range report.Config {
+				config[key] = value
+			}
+			config[types.GithubReviewersKey] = team
+			output.Reports[i].Config = config
+		}
+	}
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"GRANT and its REVOKE in the down migration",
+			[]analysistest.Migration{{Up: "GRANT SELECT ON users TO reporting;", Down: "REVOKE SELECT ON users FROM reporting;"}},
+			[]string{"1 PRV-001 WARNING 1:1", "1 PRV-001 WARNING 3:1"},
+		},
+		{
+			"GRANT to PUBLIC",
+			[]analysistest.Migration{{Up: "GRANT SELECT ON ALL TABLES IN SCHEMA app TO PUBLIC;\nREVOKE ALL ON users FROM PUBLIC;"}},
+			[]string{"1 PRV-002 FATAL 1:1", "1 PRV-001 WARNING 2:1"},
+		},
+		{
+			"role membership",
+			[]analysistest.Migration{{Up: "GRANT admin TO alice;"}},
+			[]string{"1 PRV-003 WARNING 1:1"},
+		},
+		{
+			"owner changes",
+			[]analysistest.Migration{{Up: "ALTER TABLE users OWNER TO alice;\nALTER FUNCTION f() OWNER TO alice;"}},
+			[]string{"1 PRV-004 WARNING 1:1", "1 PRV-004 WARNING 2:1"},
+		},
+		{
+			"default privileges",
+			[]analysistest.Migration{{Up: "ALTER DEFAULT PRIVILEGES GRANT SELECT ON TABLES TO reporting;\nALTER DEFAULT PRIVILEGES GRANT SELECT ON TABLES TO PUBLIC;"}},
+			[]string{"1 PRV-005 WARNING 1:1", "1 PRV-005 FATAL 2:1"},
+		},
+		{
+			"roles created and altered",
+			[]analysistest.Migration{{Up: "CREATE ROLE reporting;\nCREATE USER alice PASSWORD 'hunter2';\nALTER ROLE alice SUPERUSER;\nALTER ROLE alice SET search_path = app;"}},
+			[]string{"1 PRV-006 WARNING 1:1", "1 PRV-006 WARNING 2:1", "1 PRV-006 WARNING 3:1", "1 PRV-006 WARNING 4:1"},
+		},
+		{
+			"no privilege changes",
+			[]analysistest.Migration{{Up: "CREATE TABLE users (id bigint);\nALTER TABLE users ADD COLUMN email text;"}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "GRANT SELECT ON users;"}},
+			[]string{"1 PRV-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(nil, test.migrations...), &PrivilegesAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
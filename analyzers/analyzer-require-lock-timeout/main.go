@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	LockTimeoutMaxKey        = "lock_timeout_max"
+	DiagnosticCode           = "LCK-000"
+	DiagnosticCodeMissing    = "LCK-001"
+	DiagnosticCodeExceedsMax = "LCK-002"
+)
+
+const (
+	LockModeAccessExclusive   = "ACCESS EXCLUSIVE"
+	LockModeShareRowExclusive = "SHARE ROW EXCLUSIVE"
+	LockModeShare             = "SHARE"
+)
+
+// the settings that stop a statement from waiting on a lock forever
+var TimeoutSettings = map[string]bool{
+	"lock_timeout":      true,
+	"statement_timeout": true,
+}
+
+// postgres time units, as accepted by SET for a duration setting
+var DurationUnits = map[string]time.Duration{
+	"us":  time.Microsecond,
+	"ms":  time.Millisecond,
+	"s":   time.Second,
+	"min": time.Minute,
+	"h":   time.Hour,
+	"d":   24 * time.Hour,
+}
+
+var durationRegexp = regexp.MustCompile(`^\s*([0-9]*\.?[0-9]+)\s*([a-z]*)\s*$`)
+
+// Parses a postgres duration setting, eg: `5000` (milliseconds by default), `'5s'`, or `'1min'`
+func ParseDuration(value string) (time.Duration, error) {
+	matches := durationRegexp.FindStringSubmatch(strings.ToLower(value))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	number, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+	}
+	unit := time.Millisecond
+	if matches[2] != "" {
+		var ok bool
+		if unit, ok = DurationUnits[matches[2]]; !ok {
+			return 0, fmt.Errorf("invalid duration %q: unknown unit %q", value, matches[2])
+		}
+	}
+	return time.Duration(number * float64(unit)), nil
+}
+
+// Returns the value a SET statement assigns, eg: `SET lock_timeout = '5s'` returns `5s`
+func getSetValue(set *pg_query.VariableSetStmt) string {
+	if len(set.Args) == 0 {
+		return ""
+	}
+	constant := set.Args[0].GetAConst()
+	switch {
+	case constant.GetSval() != nil:
+		return constant.GetSval().Sval
+	case constant.GetIval() != nil:
+		return fmt.Sprint(constant.GetIval().Ival)
+	case constant.GetFval() != nil:
+		return constant.GetFval().Fval
+	}
+	return ""
+}
+
+// Returns the lock a statement takes on the objects it touches (or "" if it is not a concern),
+// along with a short description of that statement
+func GetLockMode(statement *pg_query.RawStmt) (string, string) {
+	switch {
+	case statement.Stmt.GetAlterTableStmt() != nil:
+		return LockModeAccessExclusive, "ALTER TABLE"
+	case statement.Stmt.GetIndexStmt() != nil && !statement.Stmt.GetIndexStmt().Concurrent:
+		return LockModeShare, "CREATE INDEX"
+	case statement.Stmt.GetDropStmt() != nil && !statement.Stmt.GetDropStmt().Concurrent && DroppedRelationTypes[statement.Stmt.GetDropStmt().RemoveType]:
+		return LockModeAccessExclusive, pgquery.GetStatementKind(statement)
+	case statement.Stmt.GetTruncateStmt() != nil:
+		return LockModeAccessExclusive, "TRUNCATE"
+	case statement.Stmt.GetRenameStmt() != nil:
+		return LockModeAccessExclusive, "RENAME"
+	case statement.Stmt.GetCreateTrigStmt() != nil:
+		return LockModeShareRowExclusive, "CREATE TRIGGER"
+	case statement.Stmt.GetReindexStmt() != nil && !pgquery.IsOptionEnabled(statement.Stmt.GetReindexStmt().Params, "concurrently"):
+		return LockModeAccessExclusive, "REINDEX"
+	case statement.Stmt.GetClusterStmt() != nil:
+		return LockModeAccessExclusive, "CLUSTER"
+	case statement.Stmt.GetVacuumStmt() != nil && pgquery.IsOptionEnabled(statement.Stmt.GetVacuumStmt().Options, "full"):
+		return LockModeAccessExclusive, "VACUUM FULL"
+	case statement.Stmt.GetRefreshMatViewStmt() != nil && !statement.Stmt.GetRefreshMatViewStmt().Concurrent:
+		return LockModeAccessExclusive, "REFRESH MATERIALIZED VIEW"
+	}
+	// creating a table with a foreign key locks the referenced table
+	if create := statement.Stmt.GetCreateStmt(); create != nil {
+		hasForeignKey := false
+		pgquery.Walk(create, func(node *pg_query.Node) bool {
+			if node.GetConstraint().GetContype() == pg_query.ConstrType_CONSTR_FOREIGN {
+				hasForeignKey = true
+			}
+			return !hasForeignKey
+		})
+		if hasForeignKey {
+			return LockModeShareRowExclusive, "CREATE TABLE ... REFERENCES"
+		}
+	}
+	return "", ""
+}
+
+// the kinds of objects a DROP takes an ACCESS EXCLUSIVE lock on,
+// other objects (eg: functions, types or schemas) are not read by queries so can not block them
+var DroppedRelationTypes = map[pg_query.ObjectType]bool{
+	pg_query.ObjectType_OBJECT_TABLE:    true,
+	pg_query.ObjectType_OBJECT_INDEX:    true,
+	pg_query.ObjectType_OBJECT_VIEW:     true,
+	pg_query.ObjectType_OBJECT_MATVIEW:  true,
+	pg_query.ObjectType_OBJECT_SEQUENCE: true,
+}
+
+// Returns the (qualified) names of the tables, indexes and views a lock taking statement locks,
+// or nil if they are not known
+func GetLockedRelations(statement *pg_query.RawStmt) []string {
+	relations := []*pg_query.RangeVar{}
+	switch {
+	case statement.Stmt.GetAlterTableStmt() != nil:
+		relations = append(relations, statement.Stmt.GetAlterTableStmt().Relation)
+	case statement.Stmt.GetIndexStmt() != nil:
+		relations = append(relations, statement.Stmt.GetIndexStmt().Relation)
+	case statement.Stmt.GetDropStmt() != nil:
+		drop := statement.Stmt.GetDropStmt()
+		if !DroppedRelationTypes[drop.RemoveType] {
+			return nil
+		}
+		names := []string{}
+		for _, object := range drop.Objects {
+			names = append(names, pgquery.GetObjectName(object))
+		}
+		return names
+	case statement.Stmt.GetTruncateStmt() != nil:
+		for _, relation := range statement.Stmt.GetTruncateStmt().Relations {
+			relations = append(relations, relation.GetRangeVar())
+		}
+	case statement.Stmt.GetRenameStmt() != nil:
+		relations = append(relations, statement.Stmt.GetRenameStmt().Relation)
+	case statement.Stmt.GetCreateTrigStmt() != nil:
+		relations = append(relations, statement.Stmt.GetCreateTrigStmt().Relation)
+	case statement.Stmt.GetReindexStmt() != nil:
+		relations = append(relations, statement.Stmt.GetReindexStmt().Relation)
+	case statement.Stmt.GetClusterStmt() != nil:
+		relations = append(relations, statement.Stmt.GetClusterStmt().Relation)
+	case statement.Stmt.GetVacuumStmt() != nil:
+		for _, relation := range statement.Stmt.GetVacuumStmt().Rels {
+			relations = append(relations, relation.GetVacuumRelation().GetRelation())
+		}
+	case statement.Stmt.GetRefreshMatViewStmt() != nil:
+		relations = append(relations, statement.Stmt.GetRefreshMatViewStmt().Relation)
+	case statement.Stmt.GetCreateStmt() != nil:
+		// the referenced tables of its foreign keys
+		pgquery.Walk(statement.Stmt.GetCreateStmt(), func(node *pg_query.Node) bool {
+			if constraint := node.GetConstraint(); constraint.GetContype() == pg_query.ConstrType_CONSTR_FOREIGN {
+				relations = append(relations, constraint.Pktable)
+			}
+			return true
+		})
+	}
+
+	names := []string{}
+	for _, relation := range relations {
+		// eg: a REINDEX SCHEMA, or a VACUUM of every table
+		if relation == nil {
+			return nil
+		}
+		names = append(names, pgquery.GetRangeVarName(relation))
+	}
+	return names
+}
+
+type RequireLockTimeoutAnalyzer struct{}
+
+func (a *RequireLockTimeoutAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	var maxTimeout time.Duration
+	if value, ok := analysis.GetConfigValue(ctx, LockTimeoutMaxKey); ok {
+		duration, err := ParseDuration(value)
+		if err != nil {
+			return []types.Diagnostic{types.Diagnostic{
+				LineNumber:   -1,
+				LinePosition: -1,
+				Code:         DiagnosticCode,
+				Level:        types.DiagnosticLevelFatal,
+				Text:         fmt.Errorf("error parsing config key %q: %w", LockTimeoutMaxKey, err).Error(),
+			}}
+		}
+		maxTimeout = duration
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// the timeouts set so far in this migration, keyed by setting name
+	timeouts := map[string]time.Duration{}
+	// tables (and their indexes and views) created within this same migration are not visible to any other session,
+	// so can not be contended
+	createdTables := map[string]bool{}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		if set := statement.Stmt.GetVariableSetStmt(); set != nil {
+			if set.Kind == pg_query.VariableSetKind_VAR_RESET_ALL {
+				timeouts = map[string]time.Duration{}
+			}
+			if !TimeoutSettings[set.Name] {
+				continue
+			}
+			// SET LOCAL has no effect outside of a transaction block
+			// and SET ... TO DEFAULT / RESET restore the (unknown) server default
+			if set.Kind != pg_query.VariableSetKind_VAR_SET_VALUE || (set.IsLocal && options["transaction"] == "false") {
+				delete(timeouts, set.Name)
+				continue
+			}
+			duration, err := ParseDuration(getSetValue(set))
+			if err != nil {
+				delete(timeouts, set.Name)
+				continue
+			}
+			timeouts[set.Name] = duration
+			continue
+		}
+
+		lockMode, description := GetLockMode(statement)
+		relations := GetLockedRelations(statement)
+		created := len(relations) > 0
+		for _, relation := range relations {
+			created = created && createdTables[relation]
+		}
+
+		switch {
+		case statement.Stmt.GetCreateStmt() != nil:
+			createdTables[pgquery.GetRangeVarName(statement.Stmt.GetCreateStmt().Relation)] = true
+		case statement.Stmt.GetViewStmt() != nil:
+			createdTables[pgquery.GetRangeVarName(statement.Stmt.GetViewStmt().View)] = true
+		case statement.Stmt.GetCreateTableAsStmt() != nil:
+			createdTables[pgquery.GetRangeVarName(statement.Stmt.GetCreateTableAsStmt().GetInto().GetRel())] = true
+		case statement.Stmt.GetIndexStmt() != nil && created && statement.Stmt.GetIndexStmt().Idxname != "":
+			// an index is created in the schema of its table
+			index := statement.Stmt.GetIndexStmt()
+			createdTables[pgquery.GetRangeVarName(&pg_query.RangeVar{Schemaname: index.GetRelation().GetSchemaname(), Relname: index.Idxname})] = true
+		}
+
+		if lockMode == "" || created {
+			continue
+		}
+
+		// a timeout of 0 disables the timeout entirely
+		// settings are compared in name order, so that the same setting is named when their timeouts are equal
+		settings := []string{}
+		for setting := range timeouts {
+			settings = append(settings, setting)
+		}
+		sort.Strings(settings)
+		var shortestTimeout time.Duration
+		shortestSetting := ""
+		for _, setting := range settings {
+			duration := timeouts[setting]
+			if duration > 0 && (shortestSetting == "" || duration < shortestTimeout) {
+				shortestTimeout, shortestSetting = duration, setting
+			}
+		}
+
+		if shortestSetting == "" {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         DiagnosticCodeMissing,
+				Level:        types.DiagnosticLevelWarning,
+				Text: fmt.Sprintf(
+					"%s takes a lock in %s mode without lock_timeout or statement_timeout set earlier in the migration. While it waits behind any long running transaction, it blocks all other queries on the table. Run eg: `SET lock_timeout = '5s';` first",
+					description,
+					lockMode,
+				),
+			})
+			continue
+		}
+		if maxTimeout > 0 && shortestTimeout > maxTimeout {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         DiagnosticCodeExceedsMax,
+				Level:        types.DiagnosticLevelWarning,
+				Text: fmt.Sprintf(
+					"%s takes a lock in %s mode with %s set to %s, which exceeds the maximum of %s permitted by config key %q",
+					description,
+					lockMode,
+					shortestSetting,
+					shortestTimeout,
+					maxTimeout,
+					LockTimeoutMaxKey,
+				),
+			})
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any statement taking an ACCESS EXCLUSIVE or SHARE lock
+	// - is preceded by a (short enough) lock_timeout or statement_timeout
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&RequireLockTimeoutAnalyzer{},
+		"Errors occurred around lock-taking statement(s) without a lock_timeout or statement_timeout set",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
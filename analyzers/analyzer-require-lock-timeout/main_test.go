@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"lock taking statements without a timeout",
+			nil,
+			[]analysistest.Migration{{Up: `ALTER TABLE users ADD COLUMN a int;
+CREATE INDEX users_a_idx ON users (a);
+DROP TABLE orgs;
+CREATE TRIGGER t AFTER INSERT ON users FOR EACH ROW EXECUTE FUNCTION f();
+CREATE TABLE posts (user_id bigint REFERENCES users (id));`}},
+			[]string{"1 LCK-001 WARNING 1:1", "1 LCK-001 WARNING 2:1", "1 LCK-001 WARNING 3:1", "1 LCK-001 WARNING 4:1", "1 LCK-001 WARNING 5:1"},
+		},
+		{
+			"statements not taking a contended lock",
+			nil,
+			[]analysistest.Migration{{Up: `CREATE INDEX CONCURRENTLY users_a_idx ON users (a);
+DROP FUNCTION f();
+DROP SCHEMA app;
+CREATE TABLE posts (id bigint);
+UPDATE users SET a = 1 WHERE id = 1;`, NoTransaction: true}},
+			[]string{},
+		},
+		{
+			"lock_timeout set earlier",
+			nil,
+			[]analysistest.Migration{{Up: "SET lock_timeout = '5s';\nALTER TABLE users ADD COLUMN a int;"}},
+			[]string{},
+		},
+		{
+			"statement_timeout set earlier",
+			nil,
+			[]analysistest.Migration{{Up: "SET statement_timeout = 5000;\nALTER TABLE users ADD COLUMN a int;"}},
+			[]string{},
+		},
+		{
+			"timeout set later",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE users ADD COLUMN a int;\nSET lock_timeout = '5s';"}},
+			[]string{"1 LCK-001 WARNING 1:1"},
+		},
+		{
+			"timeout disabled or reset",
+			nil,
+			[]analysistest.Migration{{Up: `SET lock_timeout = 0;
+ALTER TABLE users ADD COLUMN a int;
+SET lock_timeout = '5s';
+RESET ALL;
+ALTER TABLE users ADD COLUMN b int;`}},
+			[]string{"1 LCK-001 WARNING 2:1", "1 LCK-001 WARNING 5:1"},
+		},
+		{
+			"SET LOCAL outside of a transaction",
+			nil,
+			[]analysistest.Migration{{Up: "SET LOCAL lock_timeout = '5s';\nALTER TABLE users ADD COLUMN a int;", NoTransaction: true}},
+			[]string{"1 LCK-001 WARNING 2:1"},
+		},
+		{
+			"timeout exceeding the configured maximum",
+			map[string]string{LockTimeoutMaxKey: "10s"},
+			[]analysistest.Migration{{Up: "SET lock_timeout = '1min';\nALTER TABLE users ADD COLUMN a int;"}},
+			[]string{"1 LCK-002 WARNING 2:1"},
+		},
+		{
+			"shortest timeout within the configured maximum",
+			map[string]string{LockTimeoutMaxKey: "10s"},
+			[]analysistest.Migration{{Up: "SET statement_timeout = '1min';\nSET lock_timeout = '5s';\nALTER TABLE users ADD COLUMN a int;"}},
+			[]string{},
+		},
+		{
+			"tables created in the same migration",
+			nil,
+			[]analysistest.Migration{{Up: `CREATE TABLE app.users (id bigint);
+CREATE INDEX users_id_idx ON app.users (id);
+ALTER TABLE app.users ADD COLUMN a int;
+DROP INDEX app.users_id_idx;
+ALTER TABLE users ADD COLUMN a int;`}},
+			[]string{"1 LCK-001 WARNING 5:1"},
+		},
+		{
+			"malformed config",
+			map[string]string{LockTimeoutMaxKey: "soon"},
+			[]analysistest.Migration{{Up: "SELECT 1;"}},
+			[]string{"1 LCK-000 FATAL -1:-1", "1 LCK-000 FATAL -1:-1"},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE;"}},
+			[]string{"1 LCK-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(test.config, test.migrations...), &RequireLockTimeoutAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
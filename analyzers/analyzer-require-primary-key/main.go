@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	IgnoreTempKey            = "primary_key_ignore_temp"
+	IgnoreUnloggedKey        = "primary_key_ignore_unlogged"
+	IgnorePartitionsKey      = "primary_key_ignore_partitions"
+	DiagnosticCode           = "PKY-000"
+	DiagnosticCodeMissingKey = "PKY-001"
+)
+
+// postgres' RangeVar.relpersistence values
+const (
+	RelPersistenceTemp     = "t"
+	RelPersistenceUnlogged = "u"
+)
+
+// postgres' TableLikeClause.options bit for INCLUDING INDEXES, where each TableLikeOption is a bit (and ALL sets every bit)
+const LikeIncludingIndexes = 1 << (uint32(pg_query.TableLikeOption_CREATE_TABLE_LIKE_INDEXES) - 1)
+
+func isPrimaryKey(node *pg_query.Node) bool {
+	return node.GetConstraint().GetContype() == pg_query.ConstrType_CONSTR_PRIMARY
+}
+
+// Reports whether a CREATE TABLE statement declares a primary key, either inline or table-level
+func HasPrimaryKey(create *pg_query.CreateStmt) bool {
+	for _, element := range create.TableElts {
+		if isPrimaryKey(element) {
+			return true
+		}
+		for _, constraint := range element.GetColumnDef().GetConstraints() {
+			if isPrimaryKey(constraint) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the (possibly schema qualified) tables given a primary key by an ALTER TABLE statement across all the up migrations
+// ie, via ADD PRIMARY KEY or ADD COLUMN ... PRIMARY KEY
+func CollectAddedPrimaryKeys(migrations []types.ParsedMigration) map[string]bool {
+	tables := map[string]bool{}
+	for _, migration := range migrations {
+		parseTree, err := pg_query.Parse(migration.Up)
+		if err != nil {
+			// reported when the migration itself is analyzed
+			continue
+		}
+		for _, statement := range parseTree.Stmts {
+			alter := statement.Stmt.GetAlterTableStmt()
+			if alter == nil {
+				continue
+			}
+			for _, cmd := range alter.Cmds {
+				alterCmd := cmd.GetAlterTableCmd()
+				switch alterCmd.GetSubtype() {
+				case pg_query.AlterTableType_AT_AddConstraint:
+					if isPrimaryKey(alterCmd.GetDef()) {
+						tables[pgquery.GetRangeVarName(alter.Relation)] = true
+					}
+				case pg_query.AlterTableType_AT_AddColumn:
+					for _, constraint := range alterCmd.GetDef().GetColumnDef().GetConstraints() {
+						if isPrimaryKey(constraint) {
+							tables[pgquery.GetRangeVarName(alter.Relation)] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	return tables
+}
+
+type RequirePrimaryKeyAnalyzer struct {
+	// tables given a primary key by ALTER TABLE in any of the up migrations,
+	// so that a table created first and given its primary key afterwards is not flagged
+	addedPrimaryKeys map[string]bool
+}
+
+func (a *RequirePrimaryKeyAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	// a down migration recreates tables as they were before the up migration
+	if analysis.GetDirection(ctx) != analysis.DirectionUp {
+		return nil
+	}
+
+	ignored := map[string]bool{}
+	for _, key := range []string{IgnoreTempKey, IgnoreUnloggedKey, IgnorePartitionsKey} {
+		ignore, err := analysis.GetConfigBool(ctx, key, false)
+		if err != nil {
+			return []types.Diagnostic{types.Diagnostic{
+				LineNumber:   -1,
+				LinePosition: -1,
+				Code:         DiagnosticCode,
+				Level:        types.DiagnosticLevelFatal,
+				Text:         err.Error(),
+			}}
+		}
+		ignored[key] = ignore
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		create := statement.Stmt.GetCreateStmt()
+		if create == nil || HasPrimaryKey(create) || a.addedPrimaryKeys[pgquery.GetRangeVarName(create.Relation)] {
+			continue
+		}
+		switch {
+		case ignored[IgnoreTempKey] && create.GetRelation().GetRelpersistence() == RelPersistenceTemp:
+			continue
+		case ignored[IgnoreUnloggedKey] && create.GetRelation().GetRelpersistence() == RelPersistenceUnlogged:
+			continue
+		// a partition's primary key is inherited from its partitioned table
+		case ignored[IgnorePartitionsKey] && create.Partbound != nil:
+			continue
+		}
+		// LIKE ... INCLUDING INDEXES (or INCLUDING ALL) may copy the primary key from another table
+		copiesIndexes := false
+		for _, element := range create.TableElts {
+			if like := element.GetTableLikeClause(); like != nil && like.Options&LikeIncludingIndexes != 0 {
+				copiesIndexes = true
+			}
+		}
+		if copiesIndexes {
+			continue
+		}
+
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+		diagnostics = append(diagnostics, types.Diagnostic{
+			LineNumber:   textLocation.LineNumber,
+			LinePosition: textLocation.LineCharPosition,
+			Code:         DiagnosticCodeMissingKey,
+			Level:        types.DiagnosticLevelFatal,
+			Text: fmt.Sprintf(
+				"CREATE TABLE %q has no PRIMARY KEY, so its UPDATEs and DELETEs can not be replicated by logical replication (or change data capture). Add a PRIMARY KEY constraint, eg: `id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY`",
+				pgquery.GetRangeVarName(create.Relation),
+			),
+		})
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that across all migrations:
+	// - any CREATE TABLE operation
+	// - declares a PRIMARY KEY, or is given one by a later ALTER TABLE operation
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&RequirePrimaryKeyAnalyzer{
+			addedPrimaryKeys: CollectAddedPrimaryKeys(input.Migrations),
+		},
+		"Errors occurred around CREATE TABLE statement(s) without a PRIMARY KEY",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"table without a primary key",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE a (id bigint);"}},
+			[]string{"1 PKY-001 FATAL 1:1"},
+		},
+		{
+			"inline and table-level primary keys",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE a (id bigint PRIMARY KEY);\nCREATE TABLE b (a_id bigint, c_id bigint, PRIMARY KEY (a_id, c_id));"}},
+			[]string{},
+		},
+		{
+			"primary key added in a later migration",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE app.a (id bigint);"}, {Up: "ALTER TABLE app.a ADD PRIMARY KEY (id);"}},
+			[]string{},
+		},
+		{
+			"primary key added to a table of the same name in another schema",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE a (id bigint);"}, {Up: "ALTER TABLE app.a ADD COLUMN id bigint PRIMARY KEY;"}},
+			[]string{"1 PKY-001 FATAL 1:1"},
+		},
+		{
+			"LIKE including indexes",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE a (LIKE b INCLUDING ALL);\nCREATE TABLE c (LIKE b INCLUDING DEFAULTS);"}},
+			[]string{"1 PKY-001 FATAL 2:1"},
+		},
+		{
+			"temporary, unlogged and partition tables",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TEMP TABLE a (id bigint);\nCREATE UNLOGGED TABLE b (id bigint);\nCREATE TABLE c PARTITION OF d FOR VALUES IN (1);"}},
+			[]string{"1 PKY-001 FATAL 1:1", "1 PKY-001 FATAL 2:1", "1 PKY-001 FATAL 3:1"},
+		},
+		{
+			"temporary, unlogged and partition tables ignored",
+			map[string]string{IgnoreTempKey: "true", IgnoreUnloggedKey: "true", IgnorePartitionsKey: "true"},
+			[]analysistest.Migration{{Up: "CREATE TEMP TABLE a (id bigint);\nCREATE UNLOGGED TABLE b (id bigint);\nCREATE TABLE c PARTITION OF d FOR VALUES IN (1);"}},
+			[]string{},
+		},
+		{
+			"table recreated by a down migration",
+			nil,
+			[]analysistest.Migration{{Up: "DROP TABLE a;", Down: "CREATE TABLE a (id bigint);"}},
+			[]string{},
+		},
+		{
+			"malformed config",
+			map[string]string{IgnoreTempKey: "sometimes"},
+			[]analysistest.Migration{{Up: "CREATE TABLE a (id bigint PRIMARY KEY);"}},
+			[]string{"1 PKY-000 FATAL -1:-1"},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE a (PRIMARY KEY);"}},
+			[]string{"1 PKY-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			input := analysistest.Input(test.config, test.migrations...)
+			output := analysis.DoSimpleAnalysis(input, &RequirePrimaryKeyAnalyzer{addedPrimaryKeys: CollectAddedPrimaryKeys(input.Migrations)}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/catalog"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DiagnosticCode                = "SEQ-000"
+	DiagnosticCodeSmallPrimaryKey = "SEQ-001"
+	DiagnosticCodeForeignKeyType  = "SEQ-002"
+	DiagnosticCodeRestart         = "SEQ-003"
+	DiagnosticCodeNotOwned        = "SEQ-004"
+)
+
+// the largest value of the integer types (and the serial types backed by them) whose sequences may run out of values
+var SmallIntegerTypes = map[string]string{
+	"int2":        "32 thousand",
+	"smallserial": "32 thousand",
+	"serial2":     "32 thousand",
+	"int4":        "2 billion",
+	"serial":      "2 billion",
+	"serial4":     "2 billion",
+}
+
+var BigIntegerTypes = map[string]bool{
+	"int8":      true,
+	"bigserial": true,
+	"serial8":   true,
+}
+
+// ForeignKey is a foreign key declared by a CREATE TABLE or ALTER TABLE statement
+type ForeignKey struct {
+	// the possibly schema qualified name of the table
+	Table   string
+	Columns []string
+	// the referenced table and columns, with no columns when the referenced table's primary key is used
+	ReferencedTable   *pg_query.RangeVar
+	ReferencedColumns []string
+}
+
+// Returns the foreign keys declared by a statement, whether inline on a column or as a table constraint
+func GetForeignKeys(statement *pg_query.RawStmt) []ForeignKey {
+	table := ""
+	// every constraint declared by the statement, along with the column it is declared on (if inline)
+	constraints := []*pg_query.Constraint{}
+	columns := []string{}
+	addColumn := func(colDef *pg_query.ColumnDef) {
+		for _, constraint := range colDef.GetConstraints() {
+			constraints = append(constraints, constraint.GetConstraint())
+			columns = append(columns, colDef.Colname)
+		}
+	}
+
+	switch {
+	case statement.Stmt.GetCreateStmt() != nil:
+		create := statement.Stmt.GetCreateStmt()
+		table = pgquery.GetRangeVarName(create.Relation)
+		for _, element := range create.TableElts {
+			if colDef := element.GetColumnDef(); colDef != nil {
+				addColumn(colDef)
+			}
+			if constraint := element.GetConstraint(); constraint != nil {
+				constraints = append(constraints, constraint)
+				columns = append(columns, "")
+			}
+		}
+	case statement.Stmt.GetAlterTableStmt() != nil:
+		alter := statement.Stmt.GetAlterTableStmt()
+		table = pgquery.GetRangeVarName(alter.Relation)
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			switch alterCmd.GetSubtype() {
+			case pg_query.AlterTableType_AT_AddColumn:
+				addColumn(alterCmd.GetDef().GetColumnDef())
+			case pg_query.AlterTableType_AT_AddConstraint:
+				constraints = append(constraints, alterCmd.GetDef().GetConstraint())
+				columns = append(columns, "")
+			}
+		}
+	}
+
+	foreignKeys := []ForeignKey{}
+	for i, constraint := range constraints {
+		if constraint.GetContype() != pg_query.ConstrType_CONSTR_FOREIGN {
+			continue
+		}
+		foreignKey := ForeignKey{
+			Table:             table,
+			Columns:           pgquery.GetStringValues(constraint.FkAttrs),
+			ReferencedTable:   constraint.Pktable,
+			ReferencedColumns: pgquery.GetStringValues(constraint.PkAttrs),
+		}
+		if len(foreignKey.Columns) == 0 && columns[i] != "" {
+			foreignKey.Columns = []string{columns[i]}
+		}
+		foreignKeys = append(foreignKeys, foreignKey)
+	}
+	return foreignKeys
+}
+
+// Reports whether a statement declares a primary key, whether inline on a column or as a table constraint
+func declaresPrimaryKey(statement *pg_query.RawStmt) bool {
+	declares := false
+	pgquery.Walk(statement, func(node *pg_query.Node) bool {
+		if node.GetConstraint().GetContype() == pg_query.ConstrType_CONSTR_PRIMARY {
+			declares = true
+		}
+		return !declares
+	})
+	return declares
+}
+
+// Reports whether a sequence option sets the column owning the sequence, ie: anything but `OWNED BY NONE`
+func isOwnedBy(option *pg_query.DefElem) bool {
+	if option == nil {
+		return false
+	}
+	owner := pgquery.GetStringValues(option.GetArg().GetList().GetItems())
+	return !(len(owner) == 1 && strings.EqualFold(owner[0], "none"))
+}
+
+// Returns the sequences given an owning column by ALTER SEQUENCE ... OWNED BY across all the up migrations
+func CollectOwnedSequences(migrations []types.ParsedMigration) map[string]bool {
+	sequences := map[string]bool{}
+	for _, migration := range migrations {
+		parseTree, err := pg_query.Parse(migration.Up)
+		if err != nil {
+			// reported when the migration itself is analyzed
+			continue
+		}
+		for _, statement := range parseTree.Stmts {
+			alter := statement.Stmt.GetAlterSeqStmt()
+			if alter != nil && isOwnedBy(pgquery.GetOption(alter.Options, "owned_by")) {
+				sequences[pgquery.GetRangeVarName(alter.Sequence)] = true
+			}
+		}
+	}
+	return sequences
+}
+
+type SequencesAnalyzer struct {
+	// the schema built up by all the up migrations analyzed so far
+	schema *catalog.Catalog
+	// sequences given an owning column by ALTER SEQUENCE in any of the up migrations,
+	// so that a sequence created first and owned afterwards is not flagged
+	ownedSequences map[string]bool
+}
+
+func (a *SequencesAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// only up migrations build up the schema across migrations,
+	// a down migration only sees its own changes on top of its up migration
+	schema := a.schema
+	if analysis.GetDirection(ctx) != analysis.DirectionUp {
+		schema = a.schema.Clone()
+	}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		report := func(code string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        types.DiagnosticLevelWarning,
+				Text:         text,
+			})
+		}
+
+		switch {
+		case statement.Stmt.GetCreateSeqStmt() != nil:
+			create := statement.Stmt.GetCreateSeqStmt()
+			name := pgquery.GetRangeVarName(create.Sequence)
+			if isOwnedBy(pgquery.GetOption(create.Options, "owned_by")) || a.ownedSequences[name] {
+				continue
+			}
+			report(
+				DiagnosticCodeNotOwned,
+				fmt.Sprintf(
+					"CREATE SEQUENCE %q has no OWNED BY, so it is left behind when the column using it is dropped. Use an identity column instead, or add `OWNED BY table.column`",
+					name,
+				),
+			)
+		case statement.Stmt.GetAlterSeqStmt() != nil:
+			alter := statement.Stmt.GetAlterSeqStmt()
+			if pgquery.GetOption(alter.Options, "restart") != nil {
+				report(
+					DiagnosticCodeRestart,
+					fmt.Sprintf(
+						"ALTER SEQUENCE %q RESTART makes the sequence hand out values that may already be in use, failing inserts with duplicate key errors. Only restart a sequence past the largest value in use",
+						pgquery.GetRangeVarName(alter.Sequence),
+					),
+				)
+			}
+		case statement.Stmt.GetCreateStmt() != nil, statement.Stmt.GetAlterTableStmt() != nil:
+			schema.Apply(statement)
+			table := statement.Stmt.GetCreateStmt().GetRelation()
+			if table == nil {
+				table = statement.Stmt.GetAlterTableStmt().GetRelation()
+			}
+
+			// the column types are known once the statement has been applied, including for a column added with its key
+			if declaresPrimaryKey(statement) {
+				for _, name := range schema.GetPrimaryKey(pgquery.GetRangeVarName(table)) {
+					column := schema.Tables[pgquery.GetRangeVarName(table)].GetColumn(name)
+					if column == nil {
+						continue
+					}
+					limit, ok := SmallIntegerTypes[column.Type]
+					if !ok {
+						continue
+					}
+					report(
+						DiagnosticCodeSmallPrimaryKey,
+						fmt.Sprintf(
+							"Primary key column %q of table %q is %s, whose values run out at around %s, and changing its type later rewrites the table. Use `bigint GENERATED ALWAYS AS IDENTITY` instead",
+							name,
+							pgquery.GetRangeVarName(table),
+							column.Type,
+							limit,
+						),
+					)
+				}
+			}
+
+			for _, foreignKey := range GetForeignKeys(statement) {
+				referenced := pgquery.GetRangeVarName(foreignKey.ReferencedTable)
+				referencedColumns := foreignKey.ReferencedColumns
+				if len(referencedColumns) == 0 {
+					referencedColumns = schema.GetPrimaryKey(referenced)
+				}
+				for i, name := range foreignKey.Columns {
+					if i >= len(referencedColumns) {
+						break
+					}
+					column := schema.Tables[foreignKey.Table].GetColumn(name)
+					referencedColumn := schema.Tables[referenced].GetColumn(referencedColumns[i])
+					if column == nil || referencedColumn == nil || !BigIntegerTypes[referencedColumn.Type] || BigIntegerTypes[column.Type] {
+						continue
+					}
+					report(
+						DiagnosticCodeForeignKeyType,
+						fmt.Sprintf(
+							"Foreign key column %q of table %q is %s, but references %s column %q of table %q, so inserts fail once the referenced values no longer fit. Use `bigint` instead",
+							name,
+							pgquery.GetRangeVarName(table),
+							column.Type,
+							referencedColumn.Type,
+							referencedColumns[i],
+							pgquery.GetRangeVarName(foreignKey.ReferencedTable),
+						),
+					)
+				}
+			}
+		default:
+			schema.Apply(statement)
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that across all migrations:
+	// - any primary key is a bigint (or bigserial), not an integer (or serial)
+	// - any foreign key column referencing a bigint key is a bigint too
+	// - no ALTER SEQUENCE operation RESTARTs a sequence
+	// - any CREATE SEQUENCE operation is OWNED BY a column
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&SequencesAnalyzer{
+			schema:         catalog.New(),
+			ownedSequences: CollectOwnedSequences(input.Migrations),
+		},
+		"Errors occurred around sequence(s), identity and key column(s)",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
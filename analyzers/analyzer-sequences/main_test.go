@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+	"github.com/aprimetechnology/derisk-sql/pkg/catalog"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"integer and serial primary keys",
+			[]analysistest.Migration{{Up: "CREATE TABLE a (id serial PRIMARY KEY);\nCREATE TABLE b (id int, PRIMARY KEY (id));"}},
+			[]string{"1 SEQ-001 WARNING 1:1", "1 SEQ-001 WARNING 2:1"},
+		},
+		{
+			"bigint and uuid primary keys",
+			[]analysistest.Migration{{Up: "CREATE TABLE a (id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY);\nCREATE TABLE b (id uuid PRIMARY KEY);"}},
+			[]string{},
+		},
+		{
+			"integer primary key added with its column",
+			[]analysistest.Migration{{Up: "CREATE TABLE a (email text);"}, {Up: "ALTER TABLE a ADD COLUMN id serial4 PRIMARY KEY;"}},
+			[]string{"2 SEQ-001 WARNING 1:1"},
+		},
+		{
+			"int4 foreign key referencing a bigint primary key",
+			[]analysistest.Migration{
+				{Up: "CREATE TABLE users (id bigint PRIMARY KEY);"},
+				{Up: "CREATE TABLE orders (id bigint PRIMARY KEY, user_id int4 REFERENCES users);"},
+			},
+			[]string{"2 SEQ-002 WARNING 1:1"},
+		},
+		{
+			"bigint foreign key referencing a bigint primary key",
+			[]analysistest.Migration{
+				{Up: "CREATE TABLE users (id bigserial PRIMARY KEY);"},
+				{Up: "CREATE TABLE orders (id bigint PRIMARY KEY, user_id bigint);\nALTER TABLE orders ADD FOREIGN KEY (user_id) REFERENCES users (id);"},
+			},
+			[]string{},
+		},
+		{
+			"integer foreign key added to a table referencing a bigint column",
+			[]analysistest.Migration{
+				{Up: "CREATE TABLE app.users (id bigint PRIMARY KEY, code int8 UNIQUE);"},
+				{Up: "ALTER TABLE orders ADD COLUMN user_code int REFERENCES app.users (code);"},
+			},
+			[]string{"2 SEQ-002 WARNING 1:1"},
+		},
+		{
+			"foreign key referencing a table of unknown type",
+			[]analysistest.Migration{{Up: "CREATE TABLE orders (id bigint PRIMARY KEY, user_id int REFERENCES users);"}},
+			[]string{},
+		},
+		{
+			"ALTER SEQUENCE RESTART",
+			[]analysistest.Migration{{Up: "ALTER SEQUENCE users_id_seq RESTART WITH 1;\nALTER SEQUENCE users_id_seq INCREMENT BY 2;"}},
+			[]string{"1 SEQ-003 WARNING 1:1"},
+		},
+		{
+			"CREATE SEQUENCE without OWNED BY",
+			[]analysistest.Migration{{Up: "CREATE SEQUENCE a_seq;\nCREATE SEQUENCE b_seq OWNED BY b.id;\nCREATE SEQUENCE c_seq OWNED BY NONE;"}},
+			[]string{"1 SEQ-004 WARNING 1:1", "1 SEQ-004 WARNING 3:1"},
+		},
+		{
+			"CREATE SEQUENCE given an owner in a later migration",
+			[]analysistest.Migration{{Up: "CREATE SEQUENCE a_seq;"}, {Up: "ALTER SEQUENCE a_seq OWNED BY a.id;"}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "CREATE SEQUENCE;"}},
+			[]string{"1 SEQ-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			input := analysistest.Input(nil, test.migrations...)
+			output := analysis.DoSimpleAnalysis(
+				input,
+				&SequencesAnalyzer{schema: catalog.New(), ownedSequences: CollectOwnedSequences(input.Migrations)},
+				"",
+				[]string{},
+			)
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
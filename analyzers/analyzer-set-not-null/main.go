@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DiagnosticCode           = "NNL-000"
+	DiagnosticCodeSetNotNull = "NNL-001"
+)
+
+type NotNullCheck struct {
+	// the columns this CHECK constraint proves are never NULL
+	Columns   []string
+	Validated bool
+}
+
+// keyed by (possibly schema qualified) table name then constraint name
+type NotNullChecks map[string]map[string]*NotNullCheck
+
+func (c NotNullChecks) Clone() NotNullChecks {
+	clone := NotNullChecks{}
+	for table, checks := range c {
+		clone[table] = map[string]*NotNullCheck{}
+		for name, check := range checks {
+			copied := *check
+			clone[table][name] = &copied
+		}
+	}
+	return clone
+}
+
+func (c NotNullChecks) Add(table string, constraint *pg_query.Constraint) {
+	if constraint.GetContype() != pg_query.ConstrType_CONSTR_CHECK {
+		return
+	}
+	columns := pgquery.GetNotNullColumns(constraint.RawExpr)
+	if len(columns) == 0 {
+		return
+	}
+	name := constraint.Conname
+	if name == "" {
+		// mirror the name postgres generates for an unnamed CHECK constraint
+		name = fmt.Sprintf("%s_%s_check", table[strings.LastIndex(table, ".")+1:], columns[0])
+	}
+	if c[table] == nil {
+		c[table] = map[string]*NotNullCheck{}
+	}
+	c[table][name] = &NotNullCheck{
+		Columns:   columns,
+		Validated: !constraint.SkipValidation,
+	}
+}
+
+func (c NotNullChecks) HasValidatedCheck(table string, column string) bool {
+	for _, check := range c[table] {
+		for _, checkedColumn := range check.Columns {
+			if check.Validated && checkedColumn == column {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keep track of CHECK (col IS NOT NULL) constraints as the schema changes
+func (c NotNullChecks) ApplyStatement(statement *pg_query.RawStmt) {
+	if create := statement.Stmt.GetCreateStmt(); create != nil {
+		table := pgquery.GetRangeVarName(create.Relation)
+		delete(c, table)
+		for _, element := range create.TableElts {
+			c.Add(table, element.GetConstraint())
+			for _, constraint := range element.GetColumnDef().GetConstraints() {
+				c.Add(table, constraint.GetConstraint())
+			}
+		}
+	}
+
+	if alter := statement.Stmt.GetAlterTableStmt(); alter != nil {
+		table := pgquery.GetRangeVarName(alter.Relation)
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			switch alterCmd.GetSubtype() {
+			case pg_query.AlterTableType_AT_AddConstraint:
+				c.Add(table, alterCmd.GetDef().GetConstraint())
+			case pg_query.AlterTableType_AT_ValidateConstraint:
+				if check, ok := c[table][alterCmd.Name]; ok {
+					check.Validated = true
+				}
+			case pg_query.AlterTableType_AT_DropConstraint:
+				delete(c[table], alterCmd.Name)
+			}
+		}
+	}
+
+	if drop := statement.Stmt.GetDropStmt(); drop != nil && drop.RemoveType == pg_query.ObjectType_OBJECT_TABLE {
+		for _, object := range drop.Objects {
+			delete(c, pgquery.GetObjectName(object))
+		}
+	}
+}
+
+type SetNotNullAnalyzer struct {
+	// CHECK (col IS NOT NULL) constraints created by all the up migrations analyzed so far
+	checks NotNullChecks
+}
+
+func (a *SetNotNullAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// only up migrations build up the schema across migrations,
+	// a down migration only sees its own changes on top of its up migration
+	checks := a.checks
+	if analysis.GetDirection(ctx) != analysis.DirectionUp {
+		checks = a.checks.Clone()
+	}
+
+	// tables created within this same migration are empty, so scanning them is harmless
+	createdTables := map[string]bool{}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		if create := statement.Stmt.GetCreateStmt(); create != nil {
+			createdTables[pgquery.GetRangeVarName(create.Relation)] = true
+		}
+
+		if alter := statement.Stmt.GetAlterTableStmt(); alter != nil && !createdTables[pgquery.GetRangeVarName(alter.Relation)] {
+			byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+			textLocation := pgquery.GetTextLocation(migration, byteOffset)
+			table := pgquery.GetRangeVarName(alter.Relation)
+
+			for _, cmd := range alter.Cmds {
+				alterCmd := cmd.GetAlterTableCmd()
+				if alterCmd.GetSubtype() != pg_query.AlterTableType_AT_SetNotNull || checks.HasValidatedCheck(table, alterCmd.Name) {
+					continue
+				}
+				diagnostics = append(diagnostics, types.Diagnostic{
+					LineNumber:   textLocation.LineNumber,
+					LinePosition: textLocation.LineCharPosition,
+					Code:         DiagnosticCodeSetNotNull,
+					Level:        types.DiagnosticLevelWarning,
+					Text: strings.Join([]string{
+						fmt.Sprintf("ALTER COLUMN %q of table %q SET NOT NULL scans the whole table under an ACCESS EXCLUSIVE lock.", alterCmd.Name, table),
+						fmt.Sprintf("On Postgres 12+ the scan is skipped if a validated CHECK (%s IS NOT NULL) constraint already exists:", alterCmd.Name),
+						"add that constraint with NOT VALID, VALIDATE CONSTRAINT it in a later migration, then SET NOT NULL (and optionally drop the constraint)",
+					}, " "),
+				})
+			}
+		}
+
+		checks.ApplyStatement(statement)
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that across all migrations:
+	// - any ALTER COLUMN ... SET NOT NULL operation
+	// - is preceded by a validated CHECK (col IS NOT NULL) constraint
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&SetNotNullAnalyzer{
+			checks: NotNullChecks{},
+		},
+		"Errors occurred around SET NOT NULL statement(s) without a preceding validated CHECK (col IS NOT NULL) constraint",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
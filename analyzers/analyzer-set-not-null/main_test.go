@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"SET NOT NULL without a CHECK constraint",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ALTER COLUMN email SET NOT NULL;"}},
+			[]string{"1 NNL-001 WARNING 1:1"},
+		},
+		{
+			"SET NOT NULL after a validated CHECK constraint",
+			[]analysistest.Migration{
+				{Up: "ALTER TABLE users ADD CONSTRAINT users_email_not_null CHECK (email IS NOT NULL) NOT VALID;"},
+				{Up: "ALTER TABLE users VALIDATE CONSTRAINT users_email_not_null;"},
+				{Up: "ALTER TABLE users ALTER COLUMN email SET NOT NULL;"},
+			},
+			[]string{},
+		},
+		{
+			"SET NOT NULL after a CHECK constraint that is not validated",
+			[]analysistest.Migration{
+				{Up: "ALTER TABLE users ADD CONSTRAINT users_email_not_null CHECK (email IS NOT NULL) NOT VALID;"},
+				{Up: "ALTER TABLE users ALTER COLUMN email SET NOT NULL;"},
+			},
+			[]string{"2 NNL-001 WARNING 1:1"},
+		},
+		{
+			"SET NOT NULL after a CHECK constraint on another column",
+			[]analysistest.Migration{
+				{Up: "ALTER TABLE users ADD CONSTRAINT users_name_not_null CHECK (name IS NOT NULL AND email <> '');"},
+				{Up: "ALTER TABLE users ALTER COLUMN email SET NOT NULL;"},
+			},
+			[]string{"2 NNL-001 WARNING 1:1"},
+		},
+		{
+			"SET NOT NULL after the CHECK constraint is dropped",
+			[]analysistest.Migration{
+				{Up: "ALTER TABLE users ADD CONSTRAINT users_email_not_null CHECK (email IS NOT NULL);"},
+				{Up: "ALTER TABLE users DROP CONSTRAINT users_email_not_null;"},
+				{Up: "ALTER TABLE users ALTER COLUMN email SET NOT NULL;"},
+			},
+			[]string{"3 NNL-001 WARNING 1:1"},
+		},
+		{
+			"CHECK constraint on a table in another schema",
+			[]analysistest.Migration{
+				{Up: "ALTER TABLE app.users ADD CONSTRAINT users_email_not_null CHECK (email IS NOT NULL);"},
+				{Up: "ALTER TABLE users ALTER COLUMN email SET NOT NULL;"},
+			},
+			[]string{"2 NNL-001 WARNING 1:1"},
+		},
+		{
+			"CHECK constraint added by a down migration",
+			[]analysistest.Migration{
+				{Up: "SELECT 1;", Down: "ALTER TABLE users ADD CONSTRAINT users_email_not_null CHECK (email IS NOT NULL);"},
+				{Up: "ALTER TABLE users ALTER COLUMN email SET NOT NULL;"},
+			},
+			[]string{"2 NNL-001 WARNING 1:1"},
+		},
+		{
+			"table created in the same migration",
+			[]analysistest.Migration{{Up: `CREATE TABLE users (email text);
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;`}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "ALTER TABLE users ALTER COLUMN email SET;"}},
+			[]string{"1 NNL-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			analyzer := &SetNotNullAnalyzer{
+				checks: NotNullChecks{},
+			}
+			output := analysis.DoSimpleAnalysis(analysistest.Input(nil, test.migrations...), analyzer, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
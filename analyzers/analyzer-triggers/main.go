@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	TriggerLevelKey             = "trigger_level"
+	RuleLevelKey                = "rule_level"
+	EventTriggerLevelKey        = "event_trigger_level"
+	TriggerHotTablesKey         = "trigger_hot_tables"
+	TriggerRequestReviewersKey  = "trigger_request_reviewers"
+	DiagnosticCode              = "TRG-000"
+	DiagnosticCodeCreateTrigger = "TRG-001"
+	DiagnosticCodeCreateRule    = "TRG-002"
+	DiagnosticCodeEventTrigger  = "TRG-003"
+)
+
+// postgres' CreateTrigStmt.timing and CreateTrigStmt.events bits
+const (
+	TriggerTypeBefore   = 1 << 1
+	TriggerTypeInsert   = 1 << 2
+	TriggerTypeDelete   = 1 << 3
+	TriggerTypeUpdate   = 1 << 4
+	TriggerTypeTruncate = 1 << 5
+	TriggerTypeInstead  = 1 << 6
+)
+
+// Returns a trigger's timing and events as they are written, eg: `BEFORE INSERT OR UPDATE`
+func DescribeTrigger(trigger *pg_query.CreateTrigStmt) string {
+	timing := "AFTER"
+	switch {
+	case trigger.Timing&TriggerTypeBefore != 0:
+		timing = "BEFORE"
+	case trigger.Timing&TriggerTypeInstead != 0:
+		timing = "INSTEAD OF"
+	}
+	events := []string{}
+	for _, event := range []struct {
+		bit  int32
+		name string
+	}{
+		{TriggerTypeInsert, "INSERT"},
+		{TriggerTypeUpdate, "UPDATE"},
+		{TriggerTypeDelete, "DELETE"},
+		{TriggerTypeTruncate, "TRUNCATE"},
+	} {
+		if trigger.Events&event.bit != 0 {
+			events = append(events, event.name)
+		}
+	}
+	return timing + " " + strings.Join(events, " OR ")
+}
+
+type TriggersAnalyzer struct{}
+
+func (a *TriggersAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	levels := map[string]string{}
+	for _, key := range []string{TriggerLevelKey, RuleLevelKey, EventTriggerLevelKey} {
+		level, err := analysis.GetConfigLevel(ctx, key, types.DiagnosticLevelWarning)
+		if err != nil {
+			return []types.Diagnostic{types.Diagnostic{
+				LineNumber:   -1,
+				LinePosition: -1,
+				Code:         DiagnosticCode,
+				Level:        types.DiagnosticLevelFatal,
+				Text:         err.Error(),
+			}}
+		}
+		levels[key] = level
+	}
+	// main() reads this key to decide on the report actions, but can not report an invalid value itself
+	if _, err := analysis.GetConfigBool(ctx, TriggerRequestReviewersKey, false); err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         err.Error(),
+		}}
+	}
+	hotTables := map[string]bool{}
+	if tables, ok := analysis.GetConfigList(ctx, TriggerHotTablesKey); ok {
+		for _, table := range tables {
+			hotTables[table] = true
+		}
+	}
+	// a trigger or rule on a hot table is always fatal, whatever its configured level
+	getLevel := func(key string, relation *pg_query.RangeVar) string {
+		if hotTables[pgquery.GetRangeVarName(relation)] || hotTables[relation.GetRelname()] {
+			return types.DiagnosticLevelFatal
+		}
+		return levels[key]
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// a table created in this same migration has no rows or concurrent writers yet
+	createdTables := map[string]bool{}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		report := func(code string, level string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        level,
+				Text:         text,
+			})
+		}
+
+		switch {
+		case statement.Stmt.GetCreateStmt() != nil:
+			createdTables[pgquery.GetRangeVarName(statement.Stmt.GetCreateStmt().Relation)] = true
+		case statement.Stmt.GetCreateTrigStmt() != nil:
+			trigger := statement.Stmt.GetCreateTrigStmt()
+			table := pgquery.GetRangeVarName(trigger.Relation)
+			if createdTables[table] {
+				continue
+			}
+			report(
+				DiagnosticCodeCreateTrigger,
+				getLevel(TriggerLevelKey, trigger.Relation),
+				fmt.Sprintf(
+					"CREATE TRIGGER %q (%s) on table %q takes a SHARE ROW EXCLUSIVE lock, blocking all writes to the table, and from then on runs function %q on every matching write. Make sure the trigger's cost on the write path has been reviewed",
+					trigger.Trigname,
+					DescribeTrigger(trigger),
+					table,
+					strings.Join(pgquery.GetStringValues(trigger.Funcname), "."),
+				),
+			)
+		case statement.Stmt.GetRuleStmt() != nil:
+			rule := statement.Stmt.GetRuleStmt()
+			table := pgquery.GetRangeVarName(rule.Relation)
+			if createdTables[table] {
+				continue
+			}
+			instead := ""
+			if rule.Instead {
+				instead = "INSTEAD "
+			}
+			report(
+				DiagnosticCodeCreateRule,
+				getLevel(RuleLevelKey, rule.Relation),
+				fmt.Sprintf(
+					"CREATE RULE %q on table %q takes an ACCESS EXCLUSIVE lock, and silently rewrites every %s query against the table (DO %s...). Rules are hard to reason about, consider a trigger instead",
+					rule.Rulename,
+					table,
+					strings.TrimPrefix(rule.Event.String(), "CMD_"),
+					instead,
+				),
+			)
+		case statement.Stmt.GetCreateEventTrigStmt() != nil:
+			trigger := statement.Stmt.GetCreateEventTrigStmt()
+			report(
+				DiagnosticCodeEventTrigger,
+				levels[EventTriggerLevelKey],
+				fmt.Sprintf(
+					"CREATE EVENT TRIGGER %q runs function %q on %s for every DDL statement in the database (including later migrations), and requires superuser. Make sure it has been reviewed",
+					trigger.Trigname,
+					strings.Join(pgquery.GetStringValues(trigger.Funcname), "."),
+					trigger.Eventname,
+				),
+			)
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// an invalid value is reported as a diagnostic by TriggersAnalyzer.Analyze
+	ctx := analysis.WithConfig(context.Background(), input.Metadata.Config)
+	actions := []string{}
+	if requestReviewers, _ := analysis.GetConfigBool(ctx, TriggerRequestReviewersKey, false); requestReviewers {
+		// reviewers are read from the report config's `github_reviewers` key
+		actions = append(actions, types.RequestReviewersAction)
+	}
+
+	// analyze the input. ie, ensure that for every migration:
+	// - any CREATE TRIGGER, CREATE RULE or CREATE EVENT TRIGGER operation
+	// - is flagged for review, at its configured level
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&TriggersAnalyzer{},
+		"Errors occurred around trigger, rule and event trigger creation statement(s)",
+		actions,
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
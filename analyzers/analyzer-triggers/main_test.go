@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+const (
+	createTrigger      = "CREATE TRIGGER audit AFTER INSERT OR UPDATE ON users FOR EACH ROW EXECUTE FUNCTION audit();"
+	createRule         = "CREATE RULE no_delete AS ON DELETE TO users DO INSTEAD NOTHING;"
+	createEventTrigger = "CREATE EVENT TRIGGER log_ddl ON ddl_command_end EXECUTE FUNCTION log_ddl();"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"trigger, rule and event trigger",
+			nil,
+			[]analysistest.Migration{{Up: createTrigger + "\n" + createRule + "\n" + createEventTrigger}},
+			[]string{"1 TRG-001 WARNING 1:1", "1 TRG-002 WARNING 2:1", "1 TRG-003 WARNING 3:1"},
+		},
+		{
+			"configured levels",
+			map[string]string{TriggerLevelKey: "fatal", EventTriggerLevelKey: "FATAL"},
+			[]analysistest.Migration{{Up: createTrigger + "\n" + createRule + "\n" + createEventTrigger}},
+			[]string{"1 TRG-001 FATAL 1:1", "1 TRG-002 WARNING 2:1", "1 TRG-003 FATAL 3:1"},
+		},
+		{
+			"trigger and rule on a hot table",
+			map[string]string{TriggerHotTablesKey: "users"},
+			[]analysistest.Migration{{Up: createTrigger + "\n" + createRule + "\n" + createEventTrigger}},
+			[]string{"1 TRG-001 FATAL 1:1", "1 TRG-002 FATAL 2:1", "1 TRG-003 WARNING 3:1"},
+		},
+		{
+			"trigger on a table created in the same migration",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE users (id bigint);\n" + createTrigger + "\n" + createRule}},
+			[]string{},
+		},
+		{
+			"trigger on a table of the same name created in another schema",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TABLE app.users (id bigint);\n" + createTrigger}},
+			[]string{"1 TRG-001 WARNING 2:1"},
+		},
+		{
+			"trigger removed",
+			nil,
+			[]analysistest.Migration{{Up: "DROP TRIGGER audit ON users;"}},
+			[]string{},
+		},
+		{
+			"malformed config",
+			map[string]string{TriggerRequestReviewersKey: "everyone"},
+			[]analysistest.Migration{{Up: createTrigger}},
+			[]string{"1 TRG-000 FATAL -1:-1", "1 TRG-000 FATAL -1:-1"},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "CREATE TRIGGER audit;"}},
+			[]string{"1 TRG-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(test.config, test.migrations...), &TriggersAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
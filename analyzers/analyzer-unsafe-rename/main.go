@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	RenameLevelKey           = "rename_level"
+	DiagnosticCode           = "RNM-000"
+	DiagnosticCodeSchemaName = "RNM-001"
+	DiagnosticCodeTableName  = "RNM-002"
+	DiagnosticCodeColumnName = "RNM-003"
+	DiagnosticCodeViewName   = "RNM-004"
+)
+
+type RenameInfo struct {
+	ObjectType     string
+	DiagnosticCode string
+	// the expand/contract steps to follow instead of renaming
+	Alternative string
+}
+
+var RenameCodeToInfo = map[int]RenameInfo{
+	int(pg_query.ObjectType_OBJECT_SCHEMA): RenameInfo{
+		ObjectType:     "schema",
+		DiagnosticCode: DiagnosticCodeSchemaName,
+		Alternative:    "create the new schema, move objects into it while application code looks up both schemas (eg: via search_path), then drop the old schema in a later migration",
+	},
+	int(pg_query.ObjectType_OBJECT_TABLE): RenameInfo{
+		ObjectType:     "table",
+		DiagnosticCode: DiagnosticCodeTableName,
+		Alternative:    "rename the table and create a view with the old name in the same transaction, switch application code to the new name, then drop the view in a later migration",
+	},
+	int(pg_query.ObjectType_OBJECT_COLUMN): RenameInfo{
+		ObjectType:     "column",
+		DiagnosticCode: DiagnosticCodeColumnName,
+		Alternative:    "add the new column, backfill it (and keep it in sync with writes to the old column), switch reads and then writes to the new column, then drop the old column in a later migration",
+	},
+	int(pg_query.ObjectType_OBJECT_VIEW): RenameInfo{
+		ObjectType:     "view",
+		DiagnosticCode: DiagnosticCodeViewName,
+		Alternative:    "create a second view with the new name, switch application code to it, then drop the old view in a later migration",
+	},
+}
+
+type UnsafeRenameAnalyzer struct{}
+
+func (a *UnsafeRenameAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	level, err := analysis.GetConfigLevel(ctx, RenameLevelKey, types.DiagnosticLevelFatal)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         err.Error(),
+		}}
+	}
+
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// objects created within this same migration can not yet be referenced by running application code
+	createdTables := map[string]bool{}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		if create := statement.Stmt.GetCreateStmt(); create != nil {
+			createdTables[pgquery.GetRangeVarName(create.Relation)] = true
+		}
+		if create := statement.Stmt.GetViewStmt(); create != nil {
+			createdTables[pgquery.GetRangeVarName(create.View)] = true
+		}
+
+		rename := statement.Stmt.GetRenameStmt()
+		if rename == nil {
+			continue
+		}
+		info, ok := RenameCodeToInfo[int(rename.RenameType)]
+		if !ok {
+			continue
+		}
+
+		// schemas are identified by Subname, every other supported object by its Relation
+		oldName := rename.GetRelation().GetRelname()
+		if rename.RenameType == pg_query.ObjectType_OBJECT_SCHEMA {
+			oldName = rename.Subname
+		} else if createdTables[pgquery.GetRangeVarName(rename.Relation)] {
+			continue
+		}
+		if rename.RenameType == pg_query.ObjectType_OBJECT_COLUMN {
+			oldName = fmt.Sprintf("%s.%s", oldName, rename.Subname)
+		}
+
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+		diagnostics = append(diagnostics, types.Diagnostic{
+			LineNumber:   textLocation.LineNumber,
+			LinePosition: textLocation.LineCharPosition,
+			Code:         info.DiagnosticCode,
+			Level:        level,
+			Text: fmt.Sprintf(
+				"RENAME of %s %q to %q breaks every application replica still running code that references %q during a rolling deploy. Use expand/contract instead: %s",
+				info.ObjectType,
+				oldName,
+				rename.Newname,
+				oldName,
+				info.Alternative,
+			),
+		})
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that for every migration:
+	// - no RENAME operation is performed on an existing schema, table, column or view
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&UnsafeRenameAnalyzer{},
+		"Errors occurred around RENAME statement(s) that break application code still referencing the old name",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
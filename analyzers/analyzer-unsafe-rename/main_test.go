@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"renames",
+			nil,
+			[]analysistest.Migration{{Up: `ALTER SCHEMA app RENAME TO application;
+ALTER TABLE users RENAME TO accounts;
+ALTER TABLE orgs RENAME COLUMN name TO title;
+ALTER VIEW active_users RENAME TO current_users;`}},
+			[]string{"1 RNM-001 FATAL 1:1", "1 RNM-002 FATAL 2:1", "1 RNM-003 FATAL 3:1", "1 RNM-004 FATAL 4:1"},
+		},
+		{
+			"other renames",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER INDEX users_email_idx RENAME TO users_email_key;\nALTER TABLE users RENAME CONSTRAINT c TO d;"}},
+			[]string{},
+		},
+		{
+			"configured level",
+			map[string]string{RenameLevelKey: "warning"},
+			[]analysistest.Migration{{Up: "ALTER TABLE users RENAME TO accounts;"}},
+			[]string{"1 RNM-002 WARNING 1:1"},
+		},
+		{
+			"table and view created in the same migration",
+			nil,
+			[]analysistest.Migration{{Up: `CREATE TABLE app.users (id bigint);
+ALTER TABLE app.users RENAME COLUMN id TO user_id;
+CREATE VIEW active_users AS SELECT 1;
+ALTER VIEW active_users RENAME TO current_users;`}},
+			[]string{},
+		},
+		{
+			"table of the same name created in another schema",
+			nil,
+			[]analysistest.Migration{{Up: `CREATE TABLE app.users (id bigint);
+ALTER TABLE users RENAME TO accounts;`}},
+			[]string{"1 RNM-002 FATAL 2:1"},
+		},
+		{
+			"malformed config",
+			map[string]string{RenameLevelKey: "error"},
+			[]analysistest.Migration{{Up: "SELECT 1;"}},
+			[]string{"1 RNM-000 FATAL -1:-1", "1 RNM-000 FATAL -1:-1"},
+		},
+		{
+			"unparseable migration",
+			nil,
+			[]analysistest.Migration{{Up: "ALTER TABLE users RENAME;"}},
+			[]string{"1 RNM-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(test.config, test.migrations...), &UnsafeRenameAnalyzer{}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+	"github.com/aprimetechnology/derisk-sql/pkg/subprocess"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	DiagnosticCode                   = "VEW-000"
+	DiagnosticCodeRefresh            = "VEW-001"
+	DiagnosticCodeReplaceDropsColumn = "VEW-002"
+	DiagnosticCodeReplaceReorders    = "VEW-003"
+)
+
+// postgres' name for an output column it can not name otherwise
+const UnnamedColumn = "?column?"
+
+// Returns the name postgres gives an output column without an alias, eg: `y` for `u.y::text`
+func getColumnName(node *pg_query.Node) string {
+	switch {
+	case node.GetColumnRef() != nil:
+		return pgquery.GetUnqualifiedName(node.GetColumnRef().Fields)
+	case node.GetTypeCast() != nil:
+		if name := getColumnName(node.GetTypeCast().Arg); name != UnnamedColumn {
+			return name
+		}
+		return pgquery.GetUnqualifiedName(node.GetTypeCast().GetTypeName().GetNames())
+	case node.GetFuncCall() != nil:
+		return pgquery.GetUnqualifiedName(node.GetFuncCall().Funcname)
+	case node.GetCoalesceExpr() != nil:
+		return "coalesce"
+	case node.GetCaseExpr() != nil:
+		return "case"
+	}
+	return UnnamedColumn
+}
+
+// Returns the output column names of a view, in order,
+// or nil if they can not be known without the schema, eg: `SELECT *`
+func GetViewColumns(view *pg_query.ViewStmt) []string {
+	query := view.GetQuery().GetSelectStmt()
+	// the columns of a UNION (or INTERSECT, EXCEPT) are named by its first query
+	for query.GetLarg() != nil {
+		query = query.GetLarg()
+	}
+	if query == nil || len(query.TargetList) == 0 {
+		return nil
+	}
+
+	columns := []string{}
+	for _, target := range query.TargetList {
+		resTarget := target.GetResTarget()
+		if fields := resTarget.GetVal().GetColumnRef().GetFields(); len(fields) > 0 && fields[len(fields)-1].GetAStar() != nil {
+			return nil
+		}
+		name := resTarget.GetName()
+		if name == "" {
+			name = getColumnName(resTarget.GetVal())
+		}
+		columns = append(columns, name)
+	}
+	// explicit column names replace the leading output column names
+	for i, alias := range pgquery.GetStringValues(view.Aliases) {
+		if i < len(columns) {
+			columns[i] = alias
+		}
+	}
+	return columns
+}
+
+type ViewsAnalyzer struct {
+	// the output columns of the views created by all the up migrations analyzed so far,
+	// keyed by (possibly schema qualified) view name. a view with unknown columns has none
+	views map[string][]string
+}
+
+func (a *ViewsAnalyzer) Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic {
+	parseTree, err := pg_query.Parse(migration)
+	if err != nil {
+		return []types.Diagnostic{types.Diagnostic{
+			LineNumber:   -1,
+			LinePosition: -1,
+			Code:         DiagnosticCode,
+			Level:        types.DiagnosticLevelFatal,
+			Text:         fmt.Errorf("error parsing migration: `%s`: %w", migration, err).Error(),
+		}}
+	}
+
+	// only up migrations build up the schema across migrations,
+	// a down migration only sees its own changes on top of its up migration
+	views := a.views
+	if analysis.GetDirection(ctx) != analysis.DirectionUp {
+		views = map[string][]string{}
+		for name, columns := range a.views {
+			views[name] = columns
+		}
+	}
+
+	// materialized views created within this same migration have no readers yet
+	createdViews := map[string]bool{}
+
+	diagnostics := []types.Diagnostic{}
+	for _, statement := range parseTree.Stmts {
+		byteOffset := pgquery.SkipWhitespaceAndComments(migration, int(statement.StmtLocation))
+		textLocation := pgquery.GetTextLocation(migration, byteOffset)
+
+		report := func(code string, level string, text string) {
+			diagnostics = append(diagnostics, types.Diagnostic{
+				LineNumber:   textLocation.LineNumber,
+				LinePosition: textLocation.LineCharPosition,
+				Code:         code,
+				Level:        level,
+				Text:         text,
+			})
+		}
+
+		switch {
+		case statement.Stmt.GetCreateTableAsStmt() != nil:
+			create := statement.Stmt.GetCreateTableAsStmt()
+			if create.Objtype == pg_query.ObjectType_OBJECT_MATVIEW {
+				createdViews[pgquery.GetRangeVarName(create.GetInto().GetRel())] = true
+			}
+		case statement.Stmt.GetRefreshMatViewStmt() != nil:
+			refresh := statement.Stmt.GetRefreshMatViewStmt()
+			if refresh.Concurrent || createdViews[pgquery.GetRangeVarName(refresh.Relation)] {
+				continue
+			}
+			report(
+				DiagnosticCodeRefresh,
+				types.DiagnosticLevelWarning,
+				fmt.Sprintf(
+					"REFRESH MATERIALIZED VIEW %q takes an ACCESS EXCLUSIVE lock, blocking all reads of the view until the refresh is done. Use `REFRESH MATERIALIZED VIEW CONCURRENTLY` instead (which requires a UNIQUE index on the view)",
+					pgquery.GetRangeVarName(refresh.Relation),
+				),
+			)
+		case statement.Stmt.GetViewStmt() != nil:
+			view := statement.Stmt.GetViewStmt()
+			name := pgquery.GetRangeVarName(view.View)
+			columns := GetViewColumns(view)
+			previous, exists := views[name]
+			views[name] = columns
+			if !view.Replace || !exists || previous == nil || columns == nil {
+				continue
+			}
+
+			// CREATE OR REPLACE VIEW may only add columns to the end of the view
+			for i, column := range previous {
+				if i < len(columns) && columns[i] == column {
+					continue
+				}
+				kept := false
+				for _, replacement := range columns {
+					kept = kept || replacement == column
+				}
+				if !kept {
+					report(
+						DiagnosticCodeReplaceDropsColumn,
+						types.DiagnosticLevelFatal,
+						fmt.Sprintf(
+							"CREATE OR REPLACE VIEW %q drops column %q, which fails with `cannot drop columns from view`. DROP VIEW and CREATE VIEW instead (along with anything depending on the view)",
+							pgquery.GetRangeVarName(view.View),
+							column,
+						),
+					)
+					break
+				}
+				report(
+					DiagnosticCodeReplaceReorders,
+					types.DiagnosticLevelFatal,
+					fmt.Sprintf(
+						"CREATE OR REPLACE VIEW %q changes the order of its columns from (%s) to (%s), which fails with `cannot change name of view column`. Keep the existing columns in order and add new columns at the end",
+						pgquery.GetRangeVarName(view.View),
+						strings.Join(previous, ", "),
+						strings.Join(columns, ", "),
+					),
+				)
+				break
+			}
+		case statement.Stmt.GetDropStmt() != nil:
+			drop := statement.Stmt.GetDropStmt()
+			if drop.RemoveType == pg_query.ObjectType_OBJECT_VIEW {
+				for _, object := range drop.Objects {
+					delete(views, pgquery.GetObjectName(object))
+				}
+			}
+		case statement.Stmt.GetRenameStmt() != nil:
+			rename := statement.Stmt.GetRenameStmt()
+			name := pgquery.GetRangeVarName(rename.Relation)
+			columns, exists := views[name]
+			if !exists {
+				continue
+			}
+			switch {
+			case rename.RenameType == pg_query.ObjectType_OBJECT_VIEW:
+				delete(views, name)
+				// a view is renamed within its schema
+				views[pgquery.GetRangeVarName(&pg_query.RangeVar{Schemaname: rename.GetRelation().GetSchemaname(), Relname: rename.Newname})] = columns
+			case rename.RenameType == pg_query.ObjectType_OBJECT_COLUMN && columns != nil:
+				renamed := []string{}
+				for _, column := range columns {
+					if column == rename.Subname {
+						column = rename.Newname
+					}
+					renamed = append(renamed, column)
+				}
+				views[name] = renamed
+			}
+		}
+	}
+	return diagnostics
+}
+
+func main() {
+	// standard input expected to have JSON containing:
+	// - a list of migration objects
+	// - an overall metadata object
+	input := subprocess.Input()
+
+	// analyze the input. ie, ensure that across all migrations:
+	// - any REFRESH MATERIALIZED VIEW operation is CONCURRENTLY
+	// - any CREATE OR REPLACE VIEW operation keeps the columns of the view's earlier definition, in order
+	output := analysis.DoSimpleAnalysis(
+		input,
+		&ViewsAnalyzer{
+			views: map[string][]string{},
+		},
+		"Errors occurred around view and materialized view statement(s)",
+		[]string{},
+	)
+
+	// standard output expected to print JSON containing:
+	// - a list of report objects
+	subprocess.Output(output)
+}
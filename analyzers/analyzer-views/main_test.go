@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis/analysistest"
+)
+
+const createActiveUsers = "CREATE VIEW active_users AS SELECT id, email FROM users WHERE active;"
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations []analysistest.Migration
+		expected   []string
+	}{
+		{
+			"REFRESH MATERIALIZED VIEW without CONCURRENTLY",
+			[]analysistest.Migration{{Up: "REFRESH MATERIALIZED VIEW totals;\nREFRESH MATERIALIZED VIEW CONCURRENTLY totals;"}},
+			[]string{"1 VEW-001 WARNING 1:1"},
+		},
+		{
+			"REFRESH of a materialized view created in the same migration",
+			[]analysistest.Migration{{Up: "CREATE MATERIALIZED VIEW totals AS SELECT count(*) FROM users;\nREFRESH MATERIALIZED VIEW totals;"}},
+			[]string{},
+		},
+		{
+			"CREATE OR REPLACE VIEW adding a column at the end",
+			[]analysistest.Migration{{Up: createActiveUsers}, {Up: "CREATE OR REPLACE VIEW active_users AS SELECT u.id, u.email::text, now() AS seen_at FROM users u;"}},
+			[]string{},
+		},
+		{
+			"CREATE OR REPLACE VIEW dropping a column",
+			[]analysistest.Migration{{Up: createActiveUsers}, {Up: "CREATE OR REPLACE VIEW active_users AS SELECT id FROM users;"}},
+			[]string{"2 VEW-002 FATAL 1:1"},
+		},
+		{
+			"CREATE OR REPLACE VIEW reordering columns",
+			[]analysistest.Migration{{Up: createActiveUsers}, {Up: "CREATE OR REPLACE VIEW active_users AS SELECT email, id FROM users;"}},
+			[]string{"2 VEW-003 FATAL 1:1"},
+		},
+		{
+			"CREATE OR REPLACE VIEW after the view is dropped",
+			[]analysistest.Migration{{Up: createActiveUsers}, {Up: "DROP VIEW active_users;\nCREATE OR REPLACE VIEW active_users AS SELECT email FROM users;"}},
+			[]string{},
+		},
+		{
+			"CREATE OR REPLACE VIEW after a column is renamed",
+			[]analysistest.Migration{{Up: createActiveUsers}, {Up: "ALTER VIEW active_users RENAME COLUMN email TO address;\nCREATE OR REPLACE VIEW active_users AS SELECT id, email AS address FROM users;"}},
+			[]string{},
+		},
+		{
+			"CREATE OR REPLACE VIEW of a view of the same name in another schema",
+			[]analysistest.Migration{{Up: createActiveUsers}, {Up: "CREATE OR REPLACE VIEW app.active_users AS SELECT email FROM users;"}},
+			[]string{},
+		},
+		{
+			"CREATE OR REPLACE VIEW with unknown columns",
+			[]analysistest.Migration{{Up: "CREATE VIEW active_users AS SELECT * FROM users;"}, {Up: "CREATE OR REPLACE VIEW active_users AS SELECT email FROM users;"}},
+			[]string{},
+		},
+		{
+			"unparseable migration",
+			[]analysistest.Migration{{Up: "CREATE VIEW active_users;"}},
+			[]string{"1 VEW-000 FATAL -1:-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			output := analysis.DoSimpleAnalysis(analysistest.Input(nil, test.migrations...), &ViewsAnalyzer{views: map[string][]string{}}, "", []string{})
+			if got := analysistest.Summarize(output); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Analyze(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
@@ -40,11 +40,34 @@ var (
 	// list of analyzers provided by this repo and expected to be used
 	// by default if user does not override with their own analyzers list
 	// ie, see: github.com/aprimetechnology/derisk-sql/analyzers/* directories
+	// opt-in analyzers (eg: analyzer-idempotency, analyzer-data-types, analyzer-privileges) must be listed explicitly by the user
 	defaultAnalyzers = []string{
 		"analyzer-create-index-concurrently",
 		"analyzer-drop-index-concurrently",
 		"analyzer-index-concurrently-within-transaction",
 		"analyzer-naming-convention",
+		"analyzer-add-column-volatile-default",
+		"analyzer-alter-column-type",
+		"analyzer-constraint-not-valid",
+		"analyzer-set-not-null",
+		"analyzer-forbid-destructive-ddl",
+		"analyzer-unsafe-rename",
+		"analyzer-require-lock-timeout",
+		"analyzer-data-backfill",
+		"analyzer-implicit-index",
+		"analyzer-maintenance-commands",
+		"analyzer-enum-changes",
+		"analyzer-foreign-key-index",
+		"analyzer-require-primary-key",
+		"analyzer-irreversible-migration",
+		"analyzer-down-migration-inverse",
+		"analyzer-triggers",
+		"analyzer-extensions",
+		"analyzer-partitioning",
+		"analyzer-views",
+		"analyzer-functions",
+		"analyzer-dynamic-sql",
+		"analyzer-sequences",
 	}
 	flags       = runCheckFlags{}
 	RunCheckCmd = &cobra.Command{
@@ -6,6 +6,8 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+
 	gh "github.com/google/go-github/v62/github"
 )
 
@@ -14,8 +16,8 @@ const (
 	EnvVarGithubRepoName          = "GITHUB_REPOSITORY_NAME"
 	EnvVarGithubRepoOwner         = "GITHUB_REPOSITORY_OWNER"
 	EnvVarGithubPullRequestNumber = "GITHUB_PULL_REQUEST_NUMBER"
-	GithubReviewersKey            = "github_reviewers"
-	RequestReviewersAction        = "github:requestReviewers"
+	GithubReviewersKey            = types.GithubReviewersKey
+	RequestReviewersAction        = types.RequestReviewersAction
 )
 
 type GithubClient struct {
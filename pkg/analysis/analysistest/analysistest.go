@@ -0,0 +1,60 @@
+// Package analysistest runs analyzers over migrations in tests, the same way derisk-sql runs them
+package analysistest
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+)
+
+// Migration is a migration to analyze, run in a transaction unless NoTransaction is set
+// (ie: dbmate's `-- migrate:up transaction:false`)
+type Migration struct {
+	Up            string
+	Down          string
+	NoTransaction bool
+}
+
+// Input returns the input derisk-sql gives analyzers for the migrations, in order, along with the config
+// the migrations are versioned from 1 onwards
+func Input(config map[string]string, migrations ...Migration) types.ParsedMigrationsSummary {
+	input := types.ParsedMigrationsSummary{
+		Metadata:   types.MigrationManagerMetadata{Name: "dbmate", Config: config},
+		Migrations: []types.ParsedMigration{},
+	}
+	for i, migration := range migrations {
+		version := strconv.Itoa(i + 1)
+		options := map[string]string{"transaction": strconv.FormatBool(!migration.NoTransaction)}
+		input.Migrations = append(input.Migrations, types.ParsedMigration{
+			FileName:         version + ".sql",
+			FilePath:         version + ".sql",
+			RelativeFilePath: version + ".sql",
+			Version:          version,
+			Up:               migration.Up,
+			UpOptions:        options,
+			Down:             migration.Down,
+			DownOptions:      options,
+		})
+	}
+	return input
+}
+
+// Summarize returns the diagnostics of every report, in order, as `<version> <code> <level> <line>:<position>`
+// eg: `1 DEF-001 FATAL 2:1`
+func Summarize(output types.AnalyzedMigrationsSummary) []string {
+	summary := []string{}
+	for _, report := range output.Reports {
+		for _, diagnostic := range report.Diagnostics {
+			summary = append(summary, fmt.Sprintf(
+				"%s %s %s %d:%d",
+				report.Migration.Version,
+				diagnostic.Code,
+				diagnostic.Level,
+				diagnostic.LineNumber,
+				diagnostic.LinePosition,
+			))
+		}
+	}
+	return summary
+}
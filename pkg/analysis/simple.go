@@ -2,16 +2,37 @@ package analysis
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/aprimetechnology/derisk-sql/pkg/types"
 )
 
-const ConfigKey = "config"
+const (
+	ConfigKey     = "config"
+	DirectionKey  = "direction"
+	DirectionUp   = "up"
+	DirectionDown = "down"
+)
 
 type SimpleOneMigrationAnalyzer interface {
 	Analyze(ctx context.Context, migration string, options map[string]string) []types.Diagnostic
 }
 
+// SimpleMigrationPairAnalyzer analyzes the Up and Down contents of a migration together,
+// eg: to check that the down migration undoes the up migration.
+// down is padded with the contents of up (see PadDownMigration), so that line numbers are correct in both
+type SimpleMigrationPairAnalyzer interface {
+	AnalyzePair(ctx context.Context, up string, upOptions map[string]string, down string, downOptions map[string]string) []types.Diagnostic
+}
+
+// WithConfig returns a context holding the config map read by the GetConfig* functions,
+// eg: so a main() may read config before (or outside of) a call to DoSimpleAnalysis
+func WithConfig(ctx context.Context, config map[string]string) context.Context {
+	return context.WithValue(ctx, ConfigKey, config)
+}
+
 func GetConfigValue(ctx context.Context, key string) (string, bool) {
 	config, ok := ctx.Value(ConfigKey).(map[string]string)
 	if !ok {
@@ -21,6 +42,73 @@ func GetConfigValue(ctx context.Context, key string) (string, bool) {
 	return value, ok
 }
 
+// GetConfigList returns a comma separated config value as a list,
+// with whitespace trimmed from (and empty strings removed from) the list
+func GetConfigList(ctx context.Context, key string) ([]string, bool) {
+	value, ok := GetConfigValue(ctx, key)
+	if !ok {
+		return nil, false
+	}
+	values := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values, true
+}
+
+// GetConfigBool returns a boolean config value, or defaultValue if it is not set
+func GetConfigBool(ctx context.Context, key string, defaultValue bool) (bool, error) {
+	value, ok := GetConfigValue(ctx, key)
+	if !ok {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("error parsing config key %q value %q as a boolean: %w", key, value, err)
+	}
+	return parsed, nil
+}
+
+// GetConfigInt returns an integer config value, or defaultValue if it is not set
+func GetConfigInt(ctx context.Context, key string, defaultValue int) (int, error) {
+	value, ok := GetConfigValue(ctx, key)
+	if !ok {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return defaultValue, fmt.Errorf("error parsing config key %q value %q as an integer: %w", key, value, err)
+	}
+	return parsed, nil
+}
+
+// GetConfigLevel returns a diagnostic level config value (FATAL or WARNING), or defaultLevel if it is not set
+func GetConfigLevel(ctx context.Context, key string, defaultLevel string) (string, error) {
+	value, ok := GetConfigValue(ctx, key)
+	if !ok {
+		return defaultLevel, nil
+	}
+	level := strings.ToUpper(strings.TrimSpace(value))
+	if level != types.DiagnosticLevelFatal && level != types.DiagnosticLevelWarning {
+		return defaultLevel, fmt.Errorf(
+			"error parsing config key %q value %q: must be one of %q or %q",
+			key,
+			value,
+			types.DiagnosticLevelFatal,
+			types.DiagnosticLevelWarning,
+		)
+	}
+	return level, nil
+}
+
+// GetDirection returns whether the migration being analyzed is an up or a down migration
+func GetDirection(ctx context.Context) string {
+	direction, _ := ctx.Value(DirectionKey).(string)
+	return direction
+}
+
 func PadDownMigration(up string, down string) string {
 	padding := ""
 	for i, char := range up {
@@ -54,18 +142,14 @@ func DoSimpleAnalysis(
 	reportText string,
 	actions []string,
 ) types.AnalyzedMigrationsSummary {
-	// for this convenience "simple" package we pass a context object
-	// to maintain a consistent interface even as the contents of the
-	// context object may be modified over time, the Analyze() interface
-	// will take the same things as it did before
-	ctx := context.Background()
-	ctx = context.WithValue(ctx, ConfigKey, input.Metadata.Config)
-
-	reports := []types.Report{}
-	for _, migration := range input.Migrations {
+	return doAnalysis(input, reportText, actions, func(ctx context.Context, migration types.ParsedMigration) []types.Diagnostic {
 		diagnostics := []types.Diagnostic{}
 
-		upDiagnostics := simpleAnalyzer.Analyze(ctx, migration.Up, migration.UpOptions)
+		// migrations are always analyzed in order, up before down, so analyzers
+		// may track state across migrations (eg: the schema built up so far)
+		// as long as they only apply the Up contents to that state
+		upCtx := context.WithValue(ctx, DirectionKey, DirectionUp)
+		upDiagnostics := simpleAnalyzer.Analyze(upCtx, migration.Up, migration.UpOptions)
 		if len(upDiagnostics) != 0 {
 			for _, diagnostic := range upDiagnostics {
 				diagnostics = append(diagnostics, diagnostic)
@@ -76,13 +160,49 @@ func DoSimpleAnalysis(
 		// we pad the down migration with the contents of the up migration,
 		// where every non-'\n' character is replaced with a space ' ' character
 		paddedDown := PadDownMigration(migration.Up, migration.Down)
-		downDiagnostics := simpleAnalyzer.Analyze(ctx, paddedDown, migration.DownOptions)
+		downCtx := context.WithValue(ctx, DirectionKey, DirectionDown)
+		downDiagnostics := simpleAnalyzer.Analyze(downCtx, paddedDown, migration.DownOptions)
 		if len(downDiagnostics) != 0 {
 			for _, diagnostic := range downDiagnostics {
 				diagnostics = append(diagnostics, diagnostic)
 			}
 		}
+		return diagnostics
+	})
+}
+
+// Runs a very simple analysis of each migration's Up and Down contents together:
+// - run a given SimpleMigrationPairAnalyzer for each migration's Up and (padded) Down contents
+// - if any diagnostic is produced, store a Report for that migration file
+// - eventually, return all Reports generated
+func DoSimplePairAnalysis(
+	input types.ParsedMigrationsSummary,
+	pairAnalyzer SimpleMigrationPairAnalyzer,
+	reportText string,
+	actions []string,
+) types.AnalyzedMigrationsSummary {
+	return doAnalysis(input, reportText, actions, func(ctx context.Context, migration types.ParsedMigration) []types.Diagnostic {
+		paddedDown := PadDownMigration(migration.Up, migration.Down)
+		return pairAnalyzer.AnalyzePair(ctx, migration.Up, migration.UpOptions, paddedDown, migration.DownOptions)
+	})
+}
+
+// Stores a Report for every migration that the given function produces any diagnostic for
+func doAnalysis(
+	input types.ParsedMigrationsSummary,
+	reportText string,
+	actions []string,
+	analyze func(ctx context.Context, migration types.ParsedMigration) []types.Diagnostic,
+) types.AnalyzedMigrationsSummary {
+	// for this convenience "simple" package we pass a context object
+	// to maintain a consistent interface even as the contents of the
+	// context object may be modified over time, the Analyze() interface
+	// will take the same things as it did before
+	ctx := WithConfig(context.Background(), input.Metadata.Config)
 
+	reports := []types.Report{}
+	for _, migration := range input.Migrations {
+		diagnostics := analyze(ctx, migration)
 		if len(diagnostics) == 0 {
 			continue
 		}
@@ -0,0 +1,331 @@
+package analysis_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/analysis"
+	"github.com/aprimetechnology/derisk-sql/pkg/types"
+)
+
+const ConfigTestKey = "test_key"
+
+// Returns a context holding the given config, or no config at all if it is nil
+func configContext(config map[string]string) context.Context {
+	if config == nil {
+		return context.Background()
+	}
+	return analysis.WithConfig(context.Background(), config)
+}
+
+func TestGetConfigList(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     map[string]string
+		expected   []string
+		expectedOk bool
+	}{
+		{
+			"no config",
+			nil,
+			nil,
+			false,
+		},
+		{
+			"missing key",
+			map[string]string{"other_key": "a,b"},
+			nil,
+			false,
+		},
+		{
+			"empty value",
+			map[string]string{ConfigTestKey: ""},
+			[]string{},
+			true,
+		},
+		{
+			"single value",
+			map[string]string{ConfigTestKey: "a"},
+			[]string{"a"},
+			true,
+		},
+		{
+			"whitespace is trimmed",
+			map[string]string{ConfigTestKey: " a ,\tb,c "},
+			[]string{"a", "b", "c"},
+			true,
+		},
+		{
+			"empty items are removed",
+			map[string]string{ConfigTestKey: "a,, ,b,"},
+			[]string{"a", "b"},
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			got, ok := analysis.GetConfigList(configContext(test.config), ConfigTestKey)
+			if !reflect.DeepEqual(got, test.expected) || ok != test.expectedOk {
+				t.Fatalf("GetConfigList(%v) returned %v, %v; expected %v, %v", test.config, got, ok, test.expected, test.expectedOk)
+			}
+		})
+	}
+}
+
+func TestGetConfigBool(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		config        map[string]string
+		defaultValue  bool
+		expected      bool
+		expectedError bool
+	}{
+		{
+			"no config returns the default",
+			nil,
+			true,
+			true,
+			false,
+		},
+		{
+			"missing key returns the default",
+			map[string]string{"other_key": "false"},
+			true,
+			true,
+			false,
+		},
+		{
+			"true",
+			map[string]string{ConfigTestKey: "true"},
+			false,
+			true,
+			false,
+		},
+		{
+			"false",
+			map[string]string{ConfigTestKey: "false"},
+			true,
+			false,
+			false,
+		},
+		{
+			"numeric",
+			map[string]string{ConfigTestKey: "1"},
+			false,
+			true,
+			false,
+		},
+		{
+			"malformed value returns the default and an error",
+			map[string]string{ConfigTestKey: "yes please"},
+			true,
+			true,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			got, err := analysis.GetConfigBool(configContext(test.config), ConfigTestKey, test.defaultValue)
+			if got != test.expected || (err != nil) != test.expectedError {
+				t.Fatalf("GetConfigBool(%v) returned %v, %v; expected %v, error %v", test.config, got, err, test.expected, test.expectedError)
+			}
+		})
+	}
+}
+
+func TestGetConfigInt(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		config        map[string]string
+		defaultValue  int
+		expected      int
+		expectedError bool
+	}{
+		{
+			"no config returns the default",
+			nil,
+			10,
+			10,
+			false,
+		},
+		{
+			"missing key returns the default",
+			map[string]string{"other_key": "5"},
+			10,
+			10,
+			false,
+		},
+		{
+			"integer",
+			map[string]string{ConfigTestKey: "5"},
+			10,
+			5,
+			false,
+		},
+		{
+			"whitespace is trimmed",
+			map[string]string{ConfigTestKey: " 5 "},
+			10,
+			5,
+			false,
+		},
+		{
+			"negative integer",
+			map[string]string{ConfigTestKey: "-1"},
+			10,
+			-1,
+			false,
+		},
+		{
+			"malformed value returns the default and an error",
+			map[string]string{ConfigTestKey: "5s"},
+			10,
+			10,
+			true,
+		},
+		{
+			"empty value returns the default and an error",
+			map[string]string{ConfigTestKey: ""},
+			10,
+			10,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			got, err := analysis.GetConfigInt(configContext(test.config), ConfigTestKey, test.defaultValue)
+			if got != test.expected || (err != nil) != test.expectedError {
+				t.Fatalf("GetConfigInt(%v) returned %v, %v; expected %v, error %v", test.config, got, err, test.expected, test.expectedError)
+			}
+		})
+	}
+}
+
+func TestGetConfigLevel(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		config        map[string]string
+		expected      string
+		expectedError bool
+	}{
+		{
+			"no config returns the default",
+			nil,
+			types.DiagnosticLevelWarning,
+			false,
+		},
+		{
+			"missing key returns the default",
+			map[string]string{"other_key": "FATAL"},
+			types.DiagnosticLevelWarning,
+			false,
+		},
+		{
+			"fatal",
+			map[string]string{ConfigTestKey: "FATAL"},
+			types.DiagnosticLevelFatal,
+			false,
+		},
+		{
+			"case and whitespace are ignored",
+			map[string]string{ConfigTestKey: " fatal "},
+			types.DiagnosticLevelFatal,
+			false,
+		},
+		{
+			"warning",
+			map[string]string{ConfigTestKey: "warning"},
+			types.DiagnosticLevelWarning,
+			false,
+		},
+		{
+			"malformed value returns the default and an error",
+			map[string]string{ConfigTestKey: "ERROR"},
+			types.DiagnosticLevelWarning,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			got, err := analysis.GetConfigLevel(configContext(test.config), ConfigTestKey, types.DiagnosticLevelWarning)
+			if got != test.expected || (err != nil) != test.expectedError {
+				t.Fatalf("GetConfigLevel(%v) returned %v, %v; expected %v, error %v", test.config, got, err, test.expected, test.expectedError)
+			}
+		})
+	}
+}
+
+// reports every migration pair whose down migration does not mention the table its up migration creates
+type pairTestAnalyzer struct{}
+
+func (a pairTestAnalyzer) AnalyzePair(ctx context.Context, up string, upOptions map[string]string, down string, downOptions map[string]string) []types.Diagnostic {
+	table := strings.TrimSuffix(strings.TrimPrefix(up, "CREATE TABLE "), ";")
+	if strings.Contains(down, "DROP TABLE "+table+";") && strings.HasPrefix(down, strings.Repeat(" ", len(up)-2)+";\n") {
+		return nil
+	}
+	return []types.Diagnostic{{LineNumber: 1, LinePosition: 1, Code: "TEST", Level: types.DiagnosticLevelWarning, Text: table}}
+}
+
+func TestDoSimplePairAnalysis(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations [][2]string
+		expected   []string
+	}{
+		{
+			"no migrations",
+			[][2]string{},
+			[]string{},
+		},
+		{
+			"every pair is analyzed on its own",
+			[][2]string{
+				{"CREATE TABLE a;", "DROP TABLE a;"},
+				{"CREATE TABLE b;", "DROP TABLE a;"},
+				{"CREATE TABLE c;", "DROP TABLE c;"},
+			},
+			[]string{"b"},
+		},
+		{
+			"pairs do not depend on the order they are analyzed in",
+			[][2]string{
+				{"CREATE TABLE c;", "DROP TABLE c;"},
+				{"CREATE TABLE b;", "DROP TABLE a;"},
+				{"CREATE TABLE a;", ""},
+			},
+			[]string{"b", "a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			input := types.ParsedMigrationsSummary{}
+			for _, migration := range test.migrations {
+				input.Migrations = append(input.Migrations, types.ParsedMigration{Up: migration[0], Down: migration[1]})
+			}
+			got := []string{}
+			for _, report := range analysis.DoSimplePairAnalysis(input, pairTestAnalyzer{}, "", []string{}).Reports {
+				got = append(got, report.Diagnostics[0].Text)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("DoSimplePairAnalysis(%v) reported %v; expected %v", test.migrations, got, test.expected)
+			}
+		})
+	}
+}
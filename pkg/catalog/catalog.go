@@ -0,0 +1,631 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+type Column struct {
+	Name    string
+	Type    string
+	NotNull bool
+}
+
+type Table struct {
+	// the possibly schema qualified name of the table, as it is keyed in Catalog.Tables
+	Name    string
+	Columns []*Column
+	// the kind of every constraint (eg: PRIMARY KEY), keyed by constraint name
+	Constraints map[string]string
+	// whether the table was only referenced (eg: by ALTER TABLE) rather than created,
+	// so only the columns and constraints changed since are known
+	Partial bool
+	// the columns every constraint depends on, keyed by constraint name
+	constraintColumns map[string][]string
+}
+
+// GetColumn returns a column of a table, or nil if either does not exist
+func (t *Table) GetColumn(name string) *Column {
+	if t == nil {
+		return nil
+	}
+	for _, column := range t.Columns {
+		if column.Name == name {
+			return column
+		}
+	}
+	return nil
+}
+
+func (t *Table) dropColumn(name string) {
+	columns := []*Column{}
+	for _, column := range t.Columns {
+		if column.Name != name {
+			columns = append(columns, column)
+		}
+	}
+	t.Columns = columns
+}
+
+func (t *Table) dropConstraint(name string) {
+	delete(t.Constraints, name)
+	delete(t.constraintColumns, name)
+}
+
+type Index struct {
+	// the unqualified name of the index, which is in the same schema as its table
+	Name string
+	// the possibly schema qualified name of the table
+	Table   string
+	Columns []string
+	Unique  bool
+}
+
+// Catalog is an in-memory model of a schema, built up by applying migration statements one at a time.
+// Every object is keyed by its possibly schema qualified name, as written in the migrations (see pgquery.GetRangeVarName).
+type Catalog struct {
+	Tables  map[string]*Table
+	Indexes map[string]*Index
+	// the values of every enum type, or nil for any other type
+	Types map[string][]string
+}
+
+// Returns the name of an object in the same schema as another (possibly schema qualified) object,
+// eg: the index `users_pkey` of the table `app.users` is `app.users_pkey`
+func qualify(sibling string, name string) string {
+	return sibling[:strings.LastIndex(sibling, ".")+1] + name
+}
+
+// Returns the unqualified part of a possibly schema qualified name
+func unqualify(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func New() *Catalog {
+	return &Catalog{
+		Tables:  map[string]*Table{},
+		Indexes: map[string]*Index{},
+		Types:   map[string][]string{},
+	}
+}
+
+func (c *Catalog) Clone() *Catalog {
+	clone := New()
+	for name, table := range c.Tables {
+		copied := &Table{Name: table.Name, Constraints: map[string]string{}, Partial: table.Partial}
+		for _, column := range table.Columns {
+			copiedColumn := *column
+			copied.Columns = append(copied.Columns, &copiedColumn)
+		}
+		for constraint, kind := range table.Constraints {
+			copied.Constraints[constraint] = kind
+		}
+		if table.constraintColumns != nil {
+			copied.constraintColumns = map[string][]string{}
+			for constraint, columns := range table.constraintColumns {
+				copied.constraintColumns[constraint] = append([]string{}, columns...)
+			}
+		}
+		clone.Tables[name] = copied
+	}
+	for name, index := range c.Indexes {
+		copied := *index
+		copied.Columns = append([]string{}, index.Columns...)
+		clone.Indexes[name] = &copied
+	}
+	for name, values := range c.Types {
+		if values == nil {
+			clone.Types[name] = nil
+			continue
+		}
+		clone.Types[name] = append([]string{}, values...)
+	}
+	return clone
+}
+
+var ConstraintKinds = map[pg_query.ConstrType]string{
+	pg_query.ConstrType_CONSTR_PRIMARY:   "PRIMARY KEY",
+	pg_query.ConstrType_CONSTR_UNIQUE:    "UNIQUE",
+	pg_query.ConstrType_CONSTR_CHECK:     "CHECK",
+	pg_query.ConstrType_CONSTR_FOREIGN:   "FOREIGN KEY",
+	pg_query.ConstrType_CONSTR_EXCLUSION: "EXCLUDE",
+}
+
+// the suffix postgres appends when naming an unnamed constraint (or index)
+var constraintSuffixes = map[pg_query.ConstrType]string{
+	pg_query.ConstrType_CONSTR_PRIMARY:   "pkey",
+	pg_query.ConstrType_CONSTR_UNIQUE:    "key",
+	pg_query.ConstrType_CONSTR_CHECK:     "check",
+	pg_query.ConstrType_CONSTR_FOREIGN:   "fkey",
+	pg_query.ConstrType_CONSTR_EXCLUSION: "excl",
+}
+
+// GetConstraintName returns the name of a constraint, mirroring the name postgres generates if it is unnamed
+// column is the column an inline constraint is declared on, or "" for a table constraint
+func GetConstraintName(table string, constraint *pg_query.Constraint, column string) string {
+	if constraint.Conname != "" {
+		return constraint.Conname
+	}
+	suffix := constraintSuffixes[constraint.Contype]
+	columns := pgquery.GetStringValues(constraint.Keys)
+	if constraint.Contype == pg_query.ConstrType_CONSTR_FOREIGN {
+		columns = pgquery.GetStringValues(constraint.FkAttrs)
+	}
+	if len(columns) == 0 && column != "" {
+		columns = []string{column}
+	}
+	if constraint.Contype == pg_query.ConstrType_CONSTR_PRIMARY || len(columns) == 0 {
+		return fmt.Sprintf("%s_%s", table, suffix)
+	}
+	return fmt.Sprintf("%s_%s_%s", table, strings.Join(columns, "_"), suffix)
+}
+
+func (c *Catalog) addConstraint(table *Table, constraint *pg_query.Constraint, column *Column) {
+	switch constraint.GetContype() {
+	case pg_query.ConstrType_CONSTR_NOTNULL:
+		if column != nil {
+			column.NotNull = true
+		}
+		return
+	case pg_query.ConstrType_CONSTR_PRIMARY:
+		for _, key := range pgquery.GetStringValues(constraint.Keys) {
+			if keyColumn := table.GetColumn(key); keyColumn != nil {
+				keyColumn.NotNull = true
+			}
+		}
+		if column != nil {
+			column.NotNull = true
+		}
+	}
+	kind, ok := ConstraintKinds[constraint.GetContype()]
+	if !ok {
+		return
+	}
+	columnName := ""
+	if column != nil {
+		columnName = column.Name
+	}
+	name := GetConstraintName(unqualify(table.Name), constraint, columnName)
+	table.Constraints[name] = kind
+	if table.constraintColumns == nil {
+		table.constraintColumns = map[string][]string{}
+	}
+	table.constraintColumns[name] = getConstraintColumns(constraint, columnName)
+
+	// PRIMARY KEY and UNIQUE constraints are backed by an index of the same name
+	if constraint.Contype != pg_query.ConstrType_CONSTR_PRIMARY && constraint.Contype != pg_query.ConstrType_CONSTR_UNIQUE {
+		return
+	}
+	if existing, ok := c.Indexes[qualify(table.Name, constraint.Indexname)]; ok && constraint.Indexname != "" {
+		delete(c.Indexes, qualify(table.Name, constraint.Indexname))
+		existing.Name = name
+		c.Indexes[qualify(table.Name, name)] = existing
+		return
+	}
+	columns := pgquery.GetStringValues(constraint.Keys)
+	if len(columns) == 0 && columnName != "" {
+		columns = []string{columnName}
+	}
+	c.Indexes[qualify(table.Name, name)] = &Index{Name: name, Table: table.Name, Columns: columns, Unique: true}
+}
+
+// Returns the columns a constraint depends on, ie: the columns it is declared on or its CHECK expression reads
+func getConstraintColumns(constraint *pg_query.Constraint, column string) []string {
+	columns := pgquery.GetStringValues(constraint.Keys)
+	if constraint.Contype == pg_query.ConstrType_CONSTR_FOREIGN {
+		columns = pgquery.GetStringValues(constraint.FkAttrs)
+	}
+	pgquery.Walk(constraint.RawExpr, func(node *pg_query.Node) bool {
+		if columnRef := node.GetColumnRef(); columnRef != nil {
+			columns = append(columns, pgquery.GetUnqualifiedName(columnRef.Fields))
+		}
+		return true
+	})
+	if column != "" {
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// Drops a column of a table, along with the indexes and constraints depending on it
+func (c *Catalog) dropColumn(table *Table, name string) {
+	table.dropColumn(name)
+	for indexName, index := range c.Indexes {
+		if index.Table != table.Name {
+			continue
+		}
+		for _, column := range index.Columns {
+			if column == name {
+				delete(c.Indexes, indexName)
+				table.dropConstraint(index.Name)
+				break
+			}
+		}
+	}
+	for constraint, columns := range table.constraintColumns {
+		for _, column := range columns {
+			if column == name {
+				table.dropConstraint(constraint)
+				break
+			}
+		}
+	}
+}
+
+func (c *Catalog) addColumn(table *Table, colDef *pg_query.ColumnDef) {
+	column := &Column{Name: colDef.Colname, Type: pgquery.FormatTypeName(colDef.TypeName)}
+	table.dropColumn(column.Name)
+	table.Columns = append(table.Columns, column)
+	for _, constraint := range colDef.Constraints {
+		c.addConstraint(table, constraint.GetConstraint(), column)
+	}
+}
+
+// GetPrimaryKey returns the columns of a table's primary key, or nil if it has none (or they are not known)
+func (c *Catalog) GetPrimaryKey(table string) []string {
+	t, ok := c.Tables[table]
+	if !ok {
+		return nil
+	}
+	for name, kind := range t.Constraints {
+		if index, ok := c.Indexes[qualify(table, name)]; ok && kind == ConstraintKinds[pg_query.ConstrType_CONSTR_PRIMARY] {
+			return index.Columns
+		}
+	}
+	return nil
+}
+
+// Returns a table, or a new partial table if it was not created by any statement applied so far
+func (c *Catalog) referenceTable(name string) *Table {
+	if table, ok := c.Tables[name]; ok {
+		return table
+	}
+	table := &Table{Name: name, Constraints: map[string]string{}, Partial: true}
+	c.Tables[name] = table
+	return table
+}
+
+func (c *Catalog) dropTable(name string) {
+	delete(c.Tables, name)
+	for indexName, index := range c.Indexes {
+		if index.Table == name {
+			delete(c.Indexes, indexName)
+		}
+	}
+}
+
+// Returns the name postgres generates for an unnamed index, eg: `users_email_idx`
+func getIndexName(create *pg_query.IndexStmt, columns []string) string {
+	if create.Idxname != "" {
+		return create.Idxname
+	}
+	names := []string{}
+	for _, column := range columns {
+		if column == "" {
+			column = "expr"
+		}
+		names = append(names, column)
+	}
+	return fmt.Sprintf("%s_%s_idx", create.GetRelation().GetRelname(), strings.Join(names, "_"))
+}
+
+// Apply updates the catalog with the changes a statement makes to the schema.
+// Statements (or parts of statements) that are not modelled are ignored.
+func (c *Catalog) Apply(statement *pg_query.RawStmt) {
+	if create := statement.Stmt.GetCreateStmt(); create != nil {
+		// IF NOT EXISTS leaves an existing table untouched
+		name := pgquery.GetRangeVarName(create.Relation)
+		if _, ok := c.Tables[name]; ok && create.IfNotExists {
+			return
+		}
+		c.dropTable(name)
+		table := &Table{Name: name, Constraints: map[string]string{}}
+		c.Tables[table.Name] = table
+		for _, element := range create.TableElts {
+			if colDef := element.GetColumnDef(); colDef != nil {
+				c.addColumn(table, colDef)
+			}
+		}
+		for _, element := range create.TableElts {
+			if constraint := element.GetConstraint(); constraint != nil {
+				c.addConstraint(table, constraint, nil)
+			}
+		}
+	}
+
+	if create := pgquery.GetCreateIndexStatement(statement); create != nil {
+		columns := []string{}
+		for _, param := range create.IndexParams {
+			columns = append(columns, param.GetIndexElem().GetName())
+		}
+		table := pgquery.GetRangeVarName(create.Relation)
+		name := getIndexName(create, columns)
+		if _, ok := c.Indexes[qualify(table, name)]; !ok || !create.IfNotExists {
+			c.Indexes[qualify(table, name)] = &Index{Name: name, Table: table, Columns: columns, Unique: create.Unique}
+		}
+	}
+
+	if drop := statement.Stmt.GetDropStmt(); drop != nil {
+		for _, object := range drop.Objects {
+			name := pgquery.GetObjectName(object)
+			switch drop.RemoveType {
+			case pg_query.ObjectType_OBJECT_TABLE:
+				c.dropTable(name)
+			case pg_query.ObjectType_OBJECT_INDEX:
+				delete(c.Indexes, name)
+			case pg_query.ObjectType_OBJECT_TYPE, pg_query.ObjectType_OBJECT_DOMAIN:
+				delete(c.Types, name)
+			}
+		}
+	}
+
+	if alter := statement.Stmt.GetAlterTableStmt(); alter != nil {
+		// ALTER INDEX, ALTER SEQUENCE etc are parsed as an AlterTableStmt too
+		if alter.Objtype != pg_query.ObjectType_OBJECT_TABLE {
+			return
+		}
+		table := c.referenceTable(pgquery.GetRangeVarName(alter.Relation))
+		for _, cmd := range alter.Cmds {
+			alterCmd := cmd.GetAlterTableCmd()
+			switch alterCmd.GetSubtype() {
+			case pg_query.AlterTableType_AT_AddColumn:
+				colDef := alterCmd.GetDef().GetColumnDef()
+				if table.GetColumn(colDef.GetColname()) == nil || !alterCmd.MissingOk {
+					c.addColumn(table, colDef)
+				}
+			case pg_query.AlterTableType_AT_DropColumn:
+				c.dropColumn(table, alterCmd.Name)
+			case pg_query.AlterTableType_AT_AlterColumnType:
+				if column := table.GetColumn(alterCmd.Name); column != nil {
+					column.Type = pgquery.FormatTypeName(alterCmd.GetDef().GetColumnDef().GetTypeName())
+				}
+			case pg_query.AlterTableType_AT_SetNotNull, pg_query.AlterTableType_AT_DropNotNull:
+				if column := table.GetColumn(alterCmd.Name); column != nil {
+					column.NotNull = alterCmd.GetSubtype() == pg_query.AlterTableType_AT_SetNotNull
+				}
+			case pg_query.AlterTableType_AT_AddConstraint:
+				c.addConstraint(table, alterCmd.GetDef().GetConstraint(), nil)
+			case pg_query.AlterTableType_AT_DropConstraint:
+				table.dropConstraint(alterCmd.Name)
+				delete(c.Indexes, qualify(table.Name, alterCmd.Name))
+			}
+		}
+	}
+
+	if rename := statement.Stmt.GetRenameStmt(); rename != nil {
+		c.applyRename(rename)
+	}
+
+	if create := statement.Stmt.GetCreateEnumStmt(); create != nil {
+		c.Types[strings.Join(pgquery.GetStringValues(create.TypeName), ".")] = pgquery.GetStringValues(create.Vals)
+	}
+	if create := statement.Stmt.GetCreateDomainStmt(); create != nil {
+		c.Types[strings.Join(pgquery.GetStringValues(create.Domainname), ".")] = nil
+	}
+	if create := statement.Stmt.GetCompositeTypeStmt(); create != nil {
+		c.Types[pgquery.GetRangeVarName(create.Typevar)] = nil
+	}
+	if alter := statement.Stmt.GetAlterEnumStmt(); alter != nil {
+		c.applyAlterEnum(alter)
+	}
+}
+
+func (c *Catalog) applyRename(rename *pg_query.RenameStmt) {
+	relname := pgquery.GetRangeVarName(rename.Relation)
+	switch rename.RenameType {
+	case pg_query.ObjectType_OBJECT_TABLE:
+		if table, ok := c.Tables[relname]; ok {
+			delete(c.Tables, relname)
+			table.Name = qualify(relname, rename.Newname)
+			c.Tables[table.Name] = table
+			for _, index := range c.Indexes {
+				if index.Table == relname {
+					index.Table = table.Name
+				}
+			}
+		}
+	case pg_query.ObjectType_OBJECT_COLUMN:
+		if column := c.Tables[relname].GetColumn(rename.Subname); column != nil {
+			column.Name = rename.Newname
+			for _, columns := range c.Tables[relname].constraintColumns {
+				for i, constraintColumn := range columns {
+					if constraintColumn == rename.Subname {
+						columns[i] = rename.Newname
+					}
+				}
+			}
+			for _, index := range c.Indexes {
+				for i, indexColumn := range index.Columns {
+					if index.Table == relname && indexColumn == rename.Subname {
+						index.Columns[i] = rename.Newname
+					}
+				}
+			}
+		}
+	case pg_query.ObjectType_OBJECT_INDEX:
+		if index, ok := c.Indexes[relname]; ok {
+			delete(c.Indexes, relname)
+			index.Name = rename.Newname
+			c.Indexes[qualify(relname, rename.Newname)] = index
+		}
+	case pg_query.ObjectType_OBJECT_TABCONSTRAINT:
+		if table, ok := c.Tables[relname]; ok {
+			if kind, ok := table.Constraints[rename.Subname]; ok {
+				columns := table.constraintColumns[rename.Subname]
+				table.dropConstraint(rename.Subname)
+				table.Constraints[rename.Newname] = kind
+				if columns != nil {
+					table.constraintColumns[rename.Newname] = columns
+				}
+			}
+		}
+	case pg_query.ObjectType_OBJECT_TYPE, pg_query.ObjectType_OBJECT_DOMAIN:
+		name := pgquery.GetObjectName(rename.Object)
+		if values, ok := c.Types[name]; ok {
+			delete(c.Types, name)
+			c.Types[qualify(name, rename.Newname)] = values
+		}
+	}
+}
+
+func (c *Catalog) applyAlterEnum(alter *pg_query.AlterEnumStmt) {
+	name := strings.Join(pgquery.GetStringValues(alter.TypeName), ".")
+	values, ok := c.Types[name]
+	if !ok {
+		return
+	}
+	if alter.OldVal != "" {
+		for i, value := range values {
+			if value == alter.OldVal {
+				values[i] = alter.NewVal
+			}
+		}
+		return
+	}
+	for _, value := range values {
+		if value == alter.NewVal {
+			return
+		}
+	}
+	position := len(values)
+	for i, value := range values {
+		if value == alter.NewValNeighbor {
+			position = i
+			if alter.NewValIsAfter {
+				position = i + 1
+			}
+		}
+	}
+	values = append(values[:position], append([]string{alter.NewVal}, values[position:]...)...)
+	c.Types[name] = values
+}
+
+const (
+	DifferenceMissing = "missing"
+	DifferenceExtra   = "extra"
+	DifferenceChanged = "changed"
+)
+
+type Difference struct {
+	// uniquely identifies the object, eg: `column:users.email`
+	Key string
+	// one of DifferenceMissing, DifferenceExtra or DifferenceChanged
+	Kind string
+	// describes the object, eg: `column "email" of table "users"`
+	Object string
+	// for a changed object, how it was and how it is now
+	From string
+	To   string
+}
+
+// Diff returns the differences between two catalogs, ie: what must change to turn from into to, sorted by key
+func Diff(from *Catalog, to *Catalog) []Difference {
+	differences := []Difference{}
+	compare := func(key string, object string, fromValue string, fromOk bool, toValue string, toOk bool) {
+		switch {
+		case fromOk && !toOk:
+			differences = append(differences, Difference{Key: key, Kind: DifferenceMissing, Object: object, From: fromValue})
+		case !fromOk && toOk:
+			differences = append(differences, Difference{Key: key, Kind: DifferenceExtra, Object: object, To: toValue})
+		case fromOk && toOk && fromValue != toValue:
+			differences = append(differences, Difference{Key: key, Kind: DifferenceChanged, Object: object, From: fromValue, To: toValue})
+		}
+	}
+
+	for _, name := range unionKeys(from.Tables, to.Tables) {
+		fromTable, fromOk := from.Tables[name]
+		toTable, toOk := to.Tables[name]
+		compare("table:"+name, fmt.Sprintf("table %q", name), "", fromOk, "", toOk)
+		if !fromOk || !toOk {
+			continue
+		}
+		columns := map[string]bool{}
+		for _, column := range append(append([]*Column{}, fromTable.Columns...), toTable.Columns...) {
+			if columns[column.Name] {
+				continue
+			}
+			columns[column.Name] = true
+			fromColumn, toColumn := fromTable.GetColumn(column.Name), toTable.GetColumn(column.Name)
+			compare(
+				fmt.Sprintf("column:%s.%s", name, column.Name),
+				fmt.Sprintf("column %q of table %q", column.Name, name),
+				fromColumn.String(), fromColumn != nil,
+				toColumn.String(), toColumn != nil,
+			)
+		}
+		for _, constraint := range unionKeys(fromTable.Constraints, toTable.Constraints) {
+			fromKind, fromOk := fromTable.Constraints[constraint]
+			toKind, toOk := toTable.Constraints[constraint]
+			compare(
+				fmt.Sprintf("constraint:%s.%s", name, constraint),
+				fmt.Sprintf("constraint %q of table %q", constraint, name),
+				fromKind, fromOk,
+				toKind, toOk,
+			)
+		}
+	}
+
+	for _, name := range unionKeys(from.Indexes, to.Indexes) {
+		fromIndex, fromOk := from.Indexes[name]
+		toIndex, toOk := to.Indexes[name]
+		compare("index:"+name, fmt.Sprintf("index %q", name), fromIndex.String(), fromOk, toIndex.String(), toOk)
+	}
+
+	for _, name := range unionKeys(from.Types, to.Types) {
+		fromValues, fromOk := from.Types[name]
+		toValues, toOk := to.Types[name]
+		compare("type:"+name, fmt.Sprintf("type %q", name), formatValues(fromValues), fromOk, formatValues(toValues), toOk)
+	}
+
+	sort.Slice(differences, func(i, j int) bool {
+		return differences[i].Key < differences[j].Key
+	})
+	return differences
+}
+
+func (c *Column) String() string {
+	if c == nil {
+		return ""
+	}
+	if c.NotNull {
+		return c.Type + " NOT NULL"
+	}
+	return c.Type
+}
+
+func (i *Index) String() string {
+	if i == nil {
+		return ""
+	}
+	text := fmt.Sprintf("ON %s (%s)", i.Table, strings.Join(i.Columns, ", "))
+	if i.Unique {
+		return "UNIQUE " + text
+	}
+	return text
+}
+
+func formatValues(values []string) string {
+	if values == nil {
+		return ""
+	}
+	return "ENUM (" + strings.Join(values, ", ") + ")"
+}
+
+func unionKeys[V any](a map[string]V, b map[string]V) []string {
+	keys := []string{}
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
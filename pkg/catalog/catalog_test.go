@@ -0,0 +1,257 @@
+package catalog_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/catalog"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+func apply(t *testing.T, c *catalog.Catalog, sql string) {
+	parseTree, err := pg_query.Parse(sql)
+	if err != nil {
+		t.Fatalf("Parse(%q) returned error: %v", sql, err)
+	}
+	for _, statement := range parseTree.Stmts {
+		c.Apply(statement)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	const schema = `
+		CREATE TABLE users (id bigint PRIMARY KEY, email text NOT NULL, age int);
+		CREATE INDEX users_age_idx ON users (age);
+		CREATE TYPE mood AS ENUM ('happy', 'sad');
+	`
+	tests := []struct {
+		name     string
+		sql      string
+		expected []string
+	}{
+		{
+			"reverted changes have no differences",
+			`
+				CREATE TABLE events (id bigint PRIMARY KEY);
+				ALTER TABLE users ADD COLUMN name text, ALTER COLUMN age TYPE bigint;
+				ALTER TABLE users RENAME COLUMN email TO mail;
+				DROP TABLE events;
+				ALTER TABLE users DROP COLUMN name, ALTER COLUMN age TYPE int;
+				ALTER TABLE users RENAME COLUMN mail TO email;
+			`,
+			[]string{},
+		},
+		{
+			"new objects are extra",
+			`
+				CREATE TABLE events (id bigint);
+				CREATE UNIQUE INDEX ON users (email);
+			`,
+			[]string{
+				"extra index:users_email_idx",
+				"extra table:events",
+			},
+		},
+		{
+			"dropped objects are missing",
+			`
+				DROP INDEX users_age_idx;
+				ALTER TABLE users DROP CONSTRAINT users_pkey;
+				DROP TYPE mood;
+			`,
+			[]string{
+				"missing constraint:users.users_pkey",
+				"missing index:users_age_idx",
+				"missing index:users_pkey",
+				"missing type:mood",
+			},
+		},
+		{
+			"dropped columns are missing along with their indexes and constraints",
+			`
+				ALTER TABLE users ADD CONSTRAINT users_age_check CHECK (age > 0), ADD UNIQUE (email, age);
+				ALTER TABLE users DROP COLUMN age;
+			`,
+			[]string{
+				"missing column:users.age",
+				"missing index:users_age_idx",
+			},
+		},
+		{
+			"dropped and restored columns have no differences",
+			`
+				ALTER TABLE users DROP COLUMN age;
+				ALTER TABLE users ADD COLUMN age int;
+				CREATE INDEX users_age_idx ON users (age);
+			`,
+			[]string{},
+		},
+		{
+			"altered objects are changed",
+			`
+				ALTER TABLE users ALTER COLUMN age TYPE bigint, ALTER COLUMN email DROP NOT NULL;
+				ALTER TYPE mood ADD VALUE 'meh' BEFORE 'sad';
+			`,
+			[]string{
+				"changed column:users.age",
+				"changed column:users.email",
+				"changed type:mood",
+			},
+		},
+		{
+			"altering an unknown table adds it as a partial table",
+			"ALTER TABLE orgs ADD COLUMN name text, DROP COLUMN unknown",
+			[]string{
+				"extra table:orgs",
+			},
+		},
+		{
+			"tables in other schemas are distinct objects",
+			`
+				CREATE TABLE app.users (id bigint PRIMARY KEY);
+				ALTER TABLE app.users RENAME TO accounts;
+				DROP TABLE audit.users;
+			`,
+			[]string{
+				"extra index:app.users_pkey",
+				"extra table:app.accounts",
+			},
+		},
+		{
+			"dropping a table drops its indexes",
+			"DROP TABLE users",
+			[]string{
+				"missing index:users_age_idx",
+				"missing index:users_pkey",
+				"missing table:users",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			before := catalog.New()
+			apply(t, before, schema)
+			after := before.Clone()
+			apply(t, after, test.sql)
+
+			got := []string{}
+			for _, difference := range catalog.Diff(before, after) {
+				got = append(got, difference.Kind+" "+difference.Key)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Diff() after %q returned %v; expected %v", test.sql, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetConstraintName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		sql      string
+		expected string
+	}{
+		{
+			"named constraints keep their name",
+			"ALTER TABLE users ADD CONSTRAINT users_email UNIQUE (email)",
+			"users_email",
+		},
+		{
+			"primary keys",
+			"ALTER TABLE users ADD PRIMARY KEY (id)",
+			"users_pkey",
+		},
+		{
+			"unique constraints",
+			"ALTER TABLE users ADD UNIQUE (org_id, email)",
+			"users_org_id_email_key",
+		},
+		{
+			"foreign keys",
+			"ALTER TABLE users ADD FOREIGN KEY (org_id) REFERENCES orgs",
+			"users_org_id_fkey",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			parseTree, err := pg_query.Parse(test.sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", test.sql, err)
+			}
+			cmd := parseTree.Stmts[0].Stmt.GetAlterTableStmt().Cmds[0].GetAlterTableCmd()
+			got := catalog.GetConstraintName("users", cmd.GetDef().GetConstraint(), "")
+			if got != test.expected {
+				t.Fatalf("GetConstraintName(%q) returned %q; expected %q", test.sql, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetPrimaryKey(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		sql      string
+		expected []string
+	}{
+		{
+			"inline primary keys",
+			"CREATE TABLE users (id bigint PRIMARY KEY, email text)",
+			[]string{"id"},
+		},
+		{
+			"table primary keys",
+			"CREATE TABLE users (org_id bigint, id bigint, PRIMARY KEY (org_id, id))",
+			[]string{"org_id", "id"},
+		},
+		{
+			"added primary keys",
+			"CREATE TABLE users (id bigint); ALTER TABLE users ADD CONSTRAINT users_id PRIMARY KEY (id)",
+			[]string{"id"},
+		},
+		{
+			"primary keys added using an index",
+			"CREATE TABLE users (id bigint); CREATE UNIQUE INDEX users_id_idx ON users (id); ALTER TABLE users ADD PRIMARY KEY USING INDEX users_id_idx",
+			[]string{"id"},
+		},
+		{
+			"dropped primary keys",
+			"CREATE TABLE users (id bigint PRIMARY KEY); ALTER TABLE users DROP CONSTRAINT users_pkey",
+			nil,
+		},
+		{
+			"dropped primary key columns",
+			"CREATE TABLE users (id bigint PRIMARY KEY, email text); ALTER TABLE users DROP COLUMN id",
+			nil,
+		},
+		{
+			"unique constraints are not primary keys",
+			"CREATE TABLE users (id bigint UNIQUE)",
+			nil,
+		},
+		{
+			"unknown tables",
+			"CREATE TABLE orgs (id bigint PRIMARY KEY)",
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			c := catalog.New()
+			apply(t, c, test.sql)
+			got := c.GetPrimaryKey("users")
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("GetPrimaryKey(%q) after %q returned %v; expected %v", "users", test.sql, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package pgquery
+
+import (
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// ValidatedConstraintTypes are the constraints that check every existing row when added to a table,
+// unless added with NOT VALID
+var ValidatedConstraintTypes = map[pg_query.ConstrType]string{
+	pg_query.ConstrType_CONSTR_FOREIGN: "FOREIGN KEY",
+	pg_query.ConstrType_CONSTR_CHECK:   "CHECK",
+}
+
+// GetValidatedConstraints returns the FOREIGN KEY and CHECK constraints an ALTER TABLE command adds
+// that check every existing row, ie: those added without NOT VALID, or inline on a new column (which can not be NOT VALID)
+func GetValidatedConstraints(alterCmd *pg_query.AlterTableCmd) []*pg_query.Constraint {
+	constraints := []*pg_query.Constraint{}
+	switch alterCmd.GetSubtype() {
+	case pg_query.AlterTableType_AT_AddConstraint:
+		constraint := alterCmd.GetDef().GetConstraint()
+		if _, ok := ValidatedConstraintTypes[constraint.GetContype()]; ok && !constraint.SkipValidation {
+			constraints = append(constraints, constraint)
+		}
+	case pg_query.AlterTableType_AT_AddColumn:
+		for _, node := range alterCmd.GetDef().GetColumnDef().GetConstraints() {
+			if _, ok := ValidatedConstraintTypes[node.GetConstraint().GetContype()]; ok {
+				constraints = append(constraints, node.GetConstraint())
+			}
+		}
+	}
+	return constraints
+}
+
+// GetNotNullColumns returns the columns that a CHECK constraint expression proves are never NULL
+// ie, `col IS NOT NULL`, possibly AND'ed together with other conditions
+func GetNotNullColumns(expr *pg_query.Node) []string {
+	columns := []string{}
+	if nullTest := expr.GetNullTest(); nullTest != nil && nullTest.Nulltesttype == pg_query.NullTestType_IS_NOT_NULL {
+		if column := GetUnqualifiedName(nullTest.GetArg().GetColumnRef().GetFields()); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	if boolExpr := expr.GetBoolExpr(); boolExpr != nil && boolExpr.Boolop == pg_query.BoolExprType_AND_EXPR {
+		for _, arg := range boolExpr.Args {
+			columns = append(columns, GetNotNullColumns(arg)...)
+		}
+	}
+	return columns
+}
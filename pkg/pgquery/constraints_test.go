@@ -0,0 +1,73 @@
+package pgquery_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+func TestGetValidatedConstraints(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		sql      string
+		expected []string
+	}{
+		{"foreign key", "ALTER TABLE t ADD CONSTRAINT fk FOREIGN KEY (a) REFERENCES u (id)", []string{"fk"}},
+		{"check", "ALTER TABLE t ADD CONSTRAINT c CHECK (a > 0)", []string{"c"}},
+		{"not valid", "ALTER TABLE t ADD CONSTRAINT c CHECK (a > 0) NOT VALID", []string{}},
+		{"unique constraints are not validated", "ALTER TABLE t ADD CONSTRAINT u UNIQUE (a)", []string{}},
+		{"inline on a new column", "ALTER TABLE t ADD COLUMN a int CONSTRAINT c CHECK (a > 0) NOT NULL", []string{"c"}},
+		{"other commands", "ALTER TABLE t ALTER COLUMN a SET NOT NULL", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			parseTree, err := pg_query.Parse(test.sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", test.sql, err)
+			}
+			alterCmd := parseTree.Stmts[0].Stmt.GetAlterTableStmt().Cmds[0].GetAlterTableCmd()
+			got := []string{}
+			for _, constraint := range pgquery.GetValidatedConstraints(alterCmd) {
+				got = append(got, constraint.Conname)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("GetValidatedConstraints(%q) returned %v; expected %v", test.sql, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetNotNullColumns(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		expression string
+		expected   []string
+	}{
+		{"is not null", "a IS NOT NULL", []string{"a"}},
+		{"and", "a IS NOT NULL AND b > 0 AND t.b IS NOT NULL", []string{"a", "b"}},
+		{"or proves nothing", "a IS NOT NULL OR b IS NOT NULL", []string{}},
+		{"is null", "a IS NULL", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			sql := "SELECT " + test.expression
+			parseTree, err := pg_query.Parse(sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", sql, err)
+			}
+			expr := parseTree.Stmts[0].Stmt.GetSelectStmt().TargetList[0].GetResTarget().Val
+			if got := pgquery.GetNotNullColumns(expr); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("GetNotNullColumns(%q) returned %v; expected %v", test.expression, got, test.expected)
+			}
+		})
+	}
+}
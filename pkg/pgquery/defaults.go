@@ -0,0 +1,104 @@
+package pgquery
+
+import (
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+type DefaultKind int
+
+const (
+	// the default is a constant, eg: `DEFAULT 0` or `DEFAULT '{}'::jsonb`
+	DefaultKindConstant DefaultKind = iota
+	// the default only calls immutable or stable functions, eg: `DEFAULT now()`
+	// these are evaluated once by the ALTER TABLE, so no table rewrite is needed
+	DefaultKindStable
+	// the default calls at least one volatile function, eg: `DEFAULT clock_timestamp()`
+	// these must be evaluated for every existing row, forcing a table rewrite
+	DefaultKindVolatile
+)
+
+// builtin functions known to be VOLATILE
+var VolatileFunctions = map[string]bool{
+	"clock_timestamp":    true,
+	"timeofday":          true,
+	"random":             true,
+	"random_normal":      true,
+	"setseed":            true,
+	"nextval":            true,
+	"setval":             true,
+	"gen_random_uuid":    true,
+	"gen_random_bytes":   true,
+	"uuid_generate_v1":   true,
+	"uuid_generate_v1mc": true,
+	"uuid_generate_v4":   true,
+}
+
+// builtin functions known to be IMMUTABLE or STABLE
+// any function not found here (including user defined functions, which are
+// VOLATILE unless declared otherwise) is considered volatile unless allowlisted
+var NonVolatileFunctions = map[string]bool{
+	"now":                   true,
+	"transaction_timestamp": true,
+	"statement_timestamp":   true,
+	"current_setting":       true,
+	"to_timestamp":          true,
+	"to_date":               true,
+	"to_char":               true,
+	"date_trunc":            true,
+	"timezone":              true,
+	"make_date":             true,
+	"make_time":             true,
+	"make_timestamp":        true,
+	"make_timestamptz":      true,
+	"make_interval":         true,
+	"lower":                 true,
+	"upper":                 true,
+	"concat":                true,
+	"md5":                   true,
+	"json_build_object":     true,
+	"json_build_array":      true,
+	"jsonb_build_object":    true,
+	"jsonb_build_array":     true,
+	"array_fill":            true,
+}
+
+// serial types are shorthand for a `DEFAULT nextval(...)` column default
+var SerialTypes = map[string]bool{
+	"smallserial": true,
+	"serial":      true,
+	"bigserial":   true,
+	"serial2":     true,
+	"serial4":     true,
+	"serial8":     true,
+}
+
+// ClassifyDefault classifies a column's DEFAULT expression, returning the kind of default
+// and (for volatile defaults) the name of the offending function
+func ClassifyDefault(expr *pg_query.Node, allowlist map[string]bool) (DefaultKind, string) {
+	kind := DefaultKindConstant
+	volatileFunction := ""
+	Walk(expr, func(node *pg_query.Node) bool {
+		if kind == DefaultKindVolatile {
+			return false
+		}
+		// eg: CURRENT_TIMESTAMP, CURRENT_DATE, CURRENT_USER are all stable
+		if node.GetSqlvalueFunction() != nil {
+			kind = DefaultKindStable
+		}
+		call := node.GetFuncCall()
+		if call == nil {
+			return true
+		}
+		name := strings.ToLower(GetUnqualifiedName(call.Funcname))
+		if allowlist[name] || NonVolatileFunctions[name] {
+			kind = DefaultKindStable
+			return true
+		}
+		kind = DefaultKindVolatile
+		volatileFunction = name
+		return false
+	})
+	return kind, volatileFunction
+}
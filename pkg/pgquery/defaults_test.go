@@ -0,0 +1,45 @@
+package pgquery_test
+
+import (
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+func TestClassifyDefault(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		expression       string
+		allowlist        map[string]bool
+		expectedKind     pgquery.DefaultKind
+		expectedFunction string
+	}{
+		{"constant", "0", nil, pgquery.DefaultKindConstant, ""},
+		{"cast constant", "'{}'::jsonb", nil, pgquery.DefaultKindConstant, ""},
+		{"stable function", "now()", nil, pgquery.DefaultKindStable, ""},
+		{"sql value function", "CURRENT_TIMESTAMP", nil, pgquery.DefaultKindStable, ""},
+		{"volatile function", "clock_timestamp()", nil, pgquery.DefaultKindVolatile, "clock_timestamp"},
+		{"nested volatile function", "lower(md5(random()::text))", nil, pgquery.DefaultKindVolatile, "random"},
+		{"unknown functions are volatile", "my_schema.next_code()", nil, pgquery.DefaultKindVolatile, "next_code"},
+		{"allowlisted function", "next_code()", map[string]bool{"next_code": true}, pgquery.DefaultKindStable, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			sql := "SELECT " + test.expression
+			parseTree, err := pg_query.Parse(sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", sql, err)
+			}
+			expr := parseTree.Stmts[0].Stmt.GetSelectStmt().TargetList[0].GetResTarget().Val
+			kind, function := pgquery.ClassifyDefault(expr, test.allowlist)
+			if kind != test.expectedKind || function != test.expectedFunction {
+				t.Fatalf("ClassifyDefault(%q) returned %v, %q; expected %v, %q", test.expression, kind, function, test.expectedKind, test.expectedFunction)
+			}
+		})
+	}
+}
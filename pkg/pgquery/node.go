@@ -0,0 +1,92 @@
+package pgquery
+
+import (
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// GetStringValues returns the String values found in a list of nodes, in order.
+// eg: the Names of a TypeName, or the Funcname of a FuncCall
+// any node that is not a String is skipped
+func GetStringValues(nodes []*pg_query.Node) []string {
+	values := []string{}
+	for _, node := range nodes {
+		if str := node.GetString_(); str != nil {
+			values = append(values, str.Sval)
+		}
+	}
+	return values
+}
+
+// GetUnqualifiedName returns the last String value in a (possibly qualified) name list
+// eg: `pg_catalog.now` would return `now`
+func GetUnqualifiedName(nodes []*pg_query.Node) string {
+	values := GetStringValues(nodes)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// GetObjectName returns the dot separated, possibly qualified name of an object
+// as found in eg: DropStmt.Objects or GrantStmt.Objects, where the name may be a String, a List of Strings,
+// a TypeName, a RangeVar, or an ObjectWithArgs (whose argument types are left out)
+func GetObjectName(node *pg_query.Node) string {
+	switch {
+	case node.GetString_() != nil:
+		return node.GetString_().Sval
+	case node.GetList() != nil:
+		return strings.Join(GetStringValues(node.GetList().Items), ".")
+	case node.GetTypeName() != nil:
+		return strings.Join(GetStringValues(node.GetTypeName().Names), ".")
+	case node.GetObjectWithArgs() != nil:
+		return strings.Join(GetStringValues(node.GetObjectWithArgs().Objname), ".")
+	case node.GetRangeVar() != nil:
+		return GetRangeVarName(node.GetRangeVar())
+	}
+	return ""
+}
+
+// GetRangeVarName returns the possibly schema qualified name of a table (or other relation)
+func GetRangeVarName(rangeVar *pg_query.RangeVar) string {
+	if rangeVar.GetSchemaname() == "" {
+		return rangeVar.GetRelname()
+	}
+	return rangeVar.GetSchemaname() + "." + rangeVar.GetRelname()
+}
+
+// Walk visits every *pg_query.Node nested anywhere within the given message, depth first.
+// If visit returns false, the children of that node are not walked.
+func Walk(message proto.Message, visit func(node *pg_query.Node) bool) {
+	if message == nil {
+		return
+	}
+	walkMessage(message.ProtoReflect(), visit)
+}
+
+func walkMessage(message protoreflect.Message, visit func(node *pg_query.Node) bool) {
+	if !message.IsValid() {
+		return
+	}
+	if node, ok := message.Interface().(*pg_query.Node); ok && !visit(node) {
+		return
+	}
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		// only message fields (or lists of messages) can contain more nodes
+		if field.Message() == nil || field.IsMap() {
+			return true
+		}
+		if field.IsList() {
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				walkMessage(list.Get(i).Message(), visit)
+			}
+			return true
+		}
+		walkMessage(value.Message(), visit)
+		return true
+	})
+}
@@ -0,0 +1,230 @@
+package pgquery_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+func TestGetStringValues(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		nodes    []*pg_query.Node
+		expected []string
+	}{
+		{
+			"empty",
+			[]*pg_query.Node{},
+			[]string{},
+		},
+		{
+			"unqualified",
+			[]*pg_query.Node{pg_query.MakeStrNode("now")},
+			[]string{"now"},
+		},
+		{
+			"qualified",
+			[]*pg_query.Node{pg_query.MakeStrNode("pg_catalog"), pg_query.MakeStrNode("int4")},
+			[]string{"pg_catalog", "int4"},
+		},
+		{
+			"non-string nodes are skipped",
+			[]*pg_query.Node{pg_query.MakeStrNode("public"), pg_query.MakeAStarNode(), pg_query.MakeStrNode("users")},
+			[]string{"public", "users"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			if got := pgquery.GetStringValues(test.nodes); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("GetStringValues() returned %v; expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetUnqualifiedName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		nodes    []*pg_query.Node
+		expected string
+	}{
+		{
+			"empty",
+			[]*pg_query.Node{},
+			"",
+		},
+		{
+			"unqualified",
+			[]*pg_query.Node{pg_query.MakeStrNode("now")},
+			"now",
+		},
+		{
+			"qualified",
+			[]*pg_query.Node{pg_query.MakeStrNode("pg_catalog"), pg_query.MakeStrNode("int4")},
+			"int4",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			if got := pgquery.GetUnqualifiedName(test.nodes); got != test.expected {
+				t.Fatalf("GetUnqualifiedName() returned %q; expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetObjectName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		sql      string
+		expected []string
+	}{
+		{
+			"schemas are strings",
+			"DROP SCHEMA s1, s2",
+			[]string{"s1", "s2"},
+		},
+		{
+			"tables are lists",
+			"DROP TABLE users, audit.events",
+			[]string{"users", "audit.events"},
+		},
+		{
+			"types are type names",
+			"DROP TYPE mood, public.color",
+			[]string{"mood", "public.color"},
+		},
+		{
+			"functions are objects with args",
+			"DROP FUNCTION f(int), public.g",
+			[]string{"f", "public.g"},
+		},
+		{
+			"granted tables are range vars",
+			"GRANT SELECT ON users, public.orders TO app",
+			[]string{"users", "public.orders"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			parseTree, err := pg_query.Parse(test.sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", test.sql, err)
+			}
+			got := []string{}
+			objects := parseTree.Stmts[0].Stmt.GetDropStmt().GetObjects()
+			if grant := parseTree.Stmts[0].Stmt.GetGrantStmt(); grant != nil {
+				objects = grant.Objects
+			}
+			for _, object := range objects {
+				got = append(got, pgquery.GetObjectName(object))
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("GetObjectName() for %q returned %v; expected %v", test.sql, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetRangeVarName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		rangeVar *pg_query.RangeVar
+		expected string
+	}{
+		{"nil", nil, ""},
+		{"unqualified", pg_query.MakeSimpleRangeVar("users", 0), "users"},
+		{"qualified", pg_query.MakeFullRangeVar("audit", "events", "", 0), "audit.events"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			if got := pgquery.GetRangeVarName(test.rangeVar); got != test.expected {
+				t.Fatalf("GetRangeVarName() returned %q; expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		sql      string
+		expected []string
+	}{
+		{
+			"no function calls",
+			"SELECT 1",
+			[]string{},
+		},
+		{
+			"single function call",
+			"SELECT now()",
+			[]string{"now"},
+		},
+		{
+			"nested function calls",
+			"SELECT coalesce(lower(upper(name)), md5(random()::text)) FROM users",
+			[]string{"lower", "upper", "md5", "random"},
+		},
+		{
+			"function calls within DDL",
+			"ALTER TABLE users ADD COLUMN id uuid DEFAULT gen_random_uuid(), ADD COLUMN at timestamptz DEFAULT pg_catalog.clock_timestamp()",
+			[]string{"gen_random_uuid", "clock_timestamp"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			parseTree, err := pg_query.Parse(test.sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", test.sql, err)
+			}
+			got := []string{}
+			pgquery.Walk(parseTree, func(node *pg_query.Node) bool {
+				if call := node.GetFuncCall(); call != nil {
+					got = append(got, pgquery.GetUnqualifiedName(call.Funcname))
+				}
+				return true
+			})
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Walk(%q) visited function calls %v; expected %v", test.sql, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestWalkSkipsChildren(t *testing.T) {
+	t.Parallel()
+	parseTree, err := pg_query.Parse("SELECT lower(upper(name))")
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	got := []string{}
+	pgquery.Walk(parseTree, func(node *pg_query.Node) bool {
+		if call := node.GetFuncCall(); call != nil {
+			got = append(got, pgquery.GetUnqualifiedName(call.Funcname))
+			return false
+		}
+		return true
+	})
+	if expected := []string{"lower"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Walk() visited function calls %v; expected %v", got, expected)
+	}
+}
@@ -0,0 +1,45 @@
+package pgquery
+
+import (
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// IsOptionEnabled reports whether a list of DefElem options (eg: `VACUUM (FULL, ANALYZE)`)
+// contains the named option without explicitly disabling it (eg: `VACUUM (FULL false)`)
+func IsOptionEnabled(options []*pg_query.Node, name string) bool {
+	for _, node := range options {
+		option := node.GetDefElem()
+		if option == nil || !strings.EqualFold(option.Defname, name) {
+			continue
+		}
+		switch {
+		case option.Arg == nil:
+			return true
+		case option.Arg.GetString_() != nil:
+			switch strings.ToLower(option.Arg.GetString_().Sval) {
+			case "false", "off", "no", "0":
+				return false
+			}
+			return true
+		case option.Arg.GetInteger() != nil:
+			return option.Arg.GetInteger().Ival != 0
+		case option.Arg.GetBoolean() != nil:
+			return option.Arg.GetBoolean().Boolval
+		}
+		return true
+	}
+	return false
+}
+
+// GetOption returns the first DefElem option in a list with the given name (eg: `language` in CreateFunctionStmt.Options),
+// or nil if there is none
+func GetOption(options []*pg_query.Node, name string) *pg_query.DefElem {
+	for _, node := range options {
+		if option := node.GetDefElem(); option != nil && strings.EqualFold(option.Defname, name) {
+			return option
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package pgquery_test
+
+import (
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+func TestIsOptionEnabled(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		sql      string
+		option   string
+		expected bool
+	}{
+		{"no options", "VACUUM t", "full", false},
+		{"keyword option", "VACUUM FULL t", "full", true},
+		{"parenthesized option", "VACUUM (ANALYZE, FULL) t", "full", true},
+		{"other option", "VACUUM (ANALYZE) t", "full", false},
+		{"option disabled with false", "VACUUM (FULL false) t", "full", false},
+		{"option disabled with off", "VACUUM (FULL off) t", "full", false},
+		{"option disabled with 0", "VACUUM (FULL 0) t", "full", false},
+		{"option enabled with true", "VACUUM (FULL true) t", "full", true},
+		{"option enabled with 1", "VACUUM (FULL 1) t", "full", true},
+		{"option name is case insensitive", "VACUUM (FULL) t", "FULL", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			parseTree, err := pg_query.Parse(test.sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", test.sql, err)
+			}
+			options := parseTree.Stmts[0].Stmt.GetVacuumStmt().GetOptions()
+			if got := pgquery.IsOptionEnabled(options, test.option); got != test.expected {
+				t.Fatalf("IsOptionEnabled(%q, %q) returned %v; expected %v", test.sql, test.option, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package pgquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// plpgsql's parse modes for its queries
+const (
+	// RAW_PARSE_DEFAULT, for queries that are whole SQL statements
+	plPgSqlParseModeDefault = 0
+	// RAW_PARSE_PLPGSQL_ASSIGN1 through 3, for assignments, eg: `x := y + 1`
+	plPgSqlParseModeAssign1 = 3
+	plPgSqlParseModeAssign3 = 5
+)
+
+// PlPgSqlQuery is a query found within the body of a plpgsql function
+type PlPgSqlQuery struct {
+	// the kind of plpgsql statement the query belongs to, eg: `execsql`, `perform`, `dynexecute` or `if`
+	Statement string
+	// the field of the plpgsql statement holding the query, eg: `query`, `dynquery`, `params` or `cond`
+	Field string
+	Query string
+	// whether the query is an expression (eg: an IF condition, or the string given to EXECUTE),
+	// rather than a whole SQL statement
+	Expression bool
+	// whether the expression is an assignment, eg: `x := y + 1`
+	Assignment bool
+	// the line of the query, where line 1 is the line the function body starts on
+	LineNumber int
+}
+
+// GetPlPgSqlQueries returns the queries within a CREATE FUNCTION statement's plpgsql body, in order
+func GetPlPgSqlQueries(createFunction string) ([]PlPgSqlQuery, error) {
+	output, err := pg_query.ParsePlPgSqlToJSON(createFunction)
+	if err != nil {
+		return nil, err
+	}
+	var functions []interface{}
+	if err := json.Unmarshal([]byte(output), &functions); err != nil {
+		return nil, fmt.Errorf("error unmarshalling plpgsql parse tree: %w", err)
+	}
+
+	queries := []PlPgSqlQuery{}
+	var walk func(value interface{}, statement string, field string, lineNumber int)
+	walk = func(value interface{}, statement string, field string, lineNumber int) {
+		switch value := value.(type) {
+		case []interface{}:
+			for _, item := range value {
+				walk(item, statement, field, lineNumber)
+			}
+		case map[string]interface{}:
+			if line, ok := value["lineno"].(float64); ok {
+				lineNumber = int(line)
+			}
+			// walk in a consistent order, the queries are sorted by line afterwards
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				switch {
+				case key == "PLpgSQL_expr":
+					expr, _ := value[key].(map[string]interface{})
+					query, _ := expr["query"].(string)
+					parseMode, _ := expr["parseMode"].(float64)
+					queries = append(queries, PlPgSqlQuery{
+						Statement:  statement,
+						Field:      field,
+						Query:      query,
+						Expression: parseMode != plPgSqlParseModeDefault,
+						Assignment: parseMode >= plPgSqlParseModeAssign1 && parseMode <= plPgSqlParseModeAssign3,
+						LineNumber: lineNumber,
+					})
+				case strings.HasPrefix(key, "PLpgSQL_stmt_"):
+					walk(value[key], strings.TrimPrefix(key, "PLpgSQL_stmt_"), "", lineNumber)
+				case strings.HasPrefix(key, "PLpgSQL_"):
+					walk(value[key], statement, field, lineNumber)
+				default:
+					walk(value[key], statement, key, lineNumber)
+				}
+			}
+		}
+	}
+	walk(functions, "", "", 0)
+
+	sort.SliceStable(queries, func(i, j int) bool {
+		return queries[i].LineNumber < queries[j].LineNumber
+	})
+	return queries, nil
+}
+
+// Parse parses the query as SQL, where an expression is parsed as the target list of a SELECT,
+// eg: `x := (SELECT count(*) FROM users)` is parsed as `SELECT (SELECT count(*) FROM users)`
+func (q PlPgSqlQuery) Parse() (*pg_query.ParseResult, error) {
+	if !q.Expression {
+		return pg_query.Parse(q.Query)
+	}
+	expression := q.Query
+	if q.Assignment {
+		// the assignment target is a variable, field or array element, eg: `x`, `r.f` or `a[1]`
+		index := strings.Index(expression, ":=")
+		length := len(":=")
+		if index == -1 {
+			index, length = strings.Index(expression, "="), len("=")
+		}
+		expression = expression[index+length:]
+	}
+	return pg_query.Parse("SELECT " + expression)
+}
+
+// FunctionBody is the body of a CREATE FUNCTION statement or DO block, along with where it is in the migration
+type FunctionBody struct {
+	// the lowercase language of the body, eg: `sql` or `plpgsql`
+	Language string
+	Body     string
+	// the byte offset of the body within the migration, or -1 if it is not found as is (eg: within single quotes)
+	Offset int
+	// a CREATE FUNCTION statement with the body, to pass to GetPlPgSqlQueries
+	// as plpgsql can only be parsed as part of one (a DO block is wrapped in a temporary function)
+	Function string
+}
+
+// GetFunctionBody returns the body of a CREATE FUNCTION statement or DO block,
+// or nil if it has none (eg: a SQL standard `BEGIN ATOMIC` body, or a C function's `AS 'obj_file', 'link_symbol'`)
+func GetFunctionBody(migration string, statement *pg_query.RawStmt) *FunctionBody {
+	// DO blocks are plpgsql unless told otherwise, functions are sql unless told otherwise
+	var options []*pg_query.Node
+	language := ""
+	switch {
+	case statement.Stmt.GetDoStmt() != nil:
+		options, language = statement.Stmt.GetDoStmt().Args, "plpgsql"
+	case statement.Stmt.GetCreateFunctionStmt() != nil:
+		options, language = statement.Stmt.GetCreateFunctionStmt().Options, "sql"
+	default:
+		return nil
+	}
+	if option := GetOption(options, "language"); option != nil {
+		language = strings.ToLower(option.GetArg().GetString_().GetSval())
+	}
+	as := GetOption(options, "as")
+	if as == nil {
+		return nil
+	}
+	// a DO block's body is a String, a function's body is a List of a single String
+	bodies := GetStringValues(append([]*pg_query.Node{as.GetArg()}, as.GetArg().GetList().GetItems()...))
+	if len(bodies) != 1 {
+		return nil
+	}
+
+	// a dollar quoted body appears as is in the migration, after the AS keyword
+	body := &FunctionBody{Language: language, Body: bodies[0], Offset: -1}
+	if as.Location >= 0 && int(as.Location) <= len(migration) {
+		if index := strings.Index(migration[as.Location:], body.Body); index != -1 {
+			body.Offset = int(as.Location) + index
+		}
+	}
+
+	if statement.Stmt.GetCreateFunctionStmt() != nil {
+		end := len(migration)
+		if statement.StmtLen != 0 {
+			end = int(statement.StmtLocation + statement.StmtLen)
+		}
+		body.Function = migration[statement.StmtLocation:end]
+		return body
+	}
+	// wrap the DO block in a function, with a dollar quote tag not found in the body,
+	// starting the body on the first line so that the body's line numbers are kept
+	tag := "$do$"
+	for i := 0; strings.Contains(body.Body, tag); i++ {
+		tag = fmt.Sprintf("$do%d$", i)
+	}
+	body.Function = fmt.Sprintf("CREATE FUNCTION pg_temp.do_block() RETURNS void LANGUAGE %s AS %s%s%s", language, tag, body.Body, tag)
+	return body
+}
+
+// GetLineOffset returns the byte offset within the migration of a line of the body,
+// where line 1 is the line the body starts on, or -1 if the body is not found in the migration
+func (b *FunctionBody) GetLineOffset(lineNumber int) int {
+	if b.Offset == -1 {
+		return -1
+	}
+	offset := 0
+	for line := 1; line < lineNumber; line++ {
+		next := strings.IndexByte(b.Body[offset:], '\n')
+		if next == -1 {
+			break
+		}
+		offset += next + 1
+	}
+	return b.Offset + offset
+}
+
+// GetQueryOffset returns the byte offset within the migration of a query of a plpgsql body,
+// or -1 if the body is not found in the migration
+func (b *FunctionBody) GetQueryOffset(query PlPgSqlQuery) int {
+	offset := b.GetLineOffset(query.LineNumber)
+	if offset == -1 {
+		return -1
+	}
+	if index := strings.Index(b.Body[offset-b.Offset:], query.Query); index != -1 {
+		offset += index
+	}
+	return offset
+}
@@ -0,0 +1,236 @@
+package pgquery_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+func TestGetPlPgSqlQueries(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		sql      string
+		expected []pgquery.PlPgSqlQuery
+	}{
+		{
+			"empty body",
+			"CREATE FUNCTION f() RETURNS void LANGUAGE plpgsql AS $$ BEGIN END $$",
+			[]pgquery.PlPgSqlQuery{},
+		},
+		{
+			"statements and expressions",
+			`CREATE FUNCTION f(a int) RETURNS void LANGUAGE plpgsql AS $$
+BEGIN
+  IF a > 1 THEN
+    UPDATE users SET c = 1;
+  END IF;
+  EXECUTE 'DROP TABLE ' || quote_ident('x');
+  a := a + 1;
+END
+$$`,
+			[]pgquery.PlPgSqlQuery{
+				{Statement: "if", Field: "cond", Query: "a > 1", Expression: true, LineNumber: 3},
+				{Statement: "execsql", Field: "sqlstmt", Query: "UPDATE users SET c = 1", LineNumber: 4},
+				{Statement: "dynexecute", Field: "query", Query: "'DROP TABLE ' || quote_ident('x')", Expression: true, LineNumber: 6},
+				{Statement: "assign", Field: "expr", Query: "a := a + 1", Expression: true, Assignment: true, LineNumber: 7},
+			},
+		},
+		{
+			"dynamic queries and their parameters",
+			`CREATE FUNCTION f(a int) RETURNS SETOF int LANGUAGE plpgsql AS $$
+BEGIN
+  EXECUTE 'DELETE FROM users WHERE id = $1' USING a;
+  RETURN QUERY SELECT 1;
+  RETURN QUERY EXECUTE 'SELECT $1' USING a + 1;
+END
+$$`,
+			[]pgquery.PlPgSqlQuery{
+				{Statement: "dynexecute", Field: "params", Query: "a", Expression: true, LineNumber: 3},
+				{Statement: "dynexecute", Field: "query", Query: "'DELETE FROM users WHERE id = $1'", Expression: true, LineNumber: 3},
+				{Statement: "return_query", Field: "query", Query: "SELECT 1", LineNumber: 4},
+				{Statement: "return_query", Field: "dynquery", Query: "'SELECT $1'", Expression: true, LineNumber: 5},
+				{Statement: "return_query", Field: "params", Query: "a + 1", Expression: true, LineNumber: 5},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			got, err := pgquery.GetPlPgSqlQueries(test.sql)
+			if err != nil {
+				t.Fatalf("GetPlPgSqlQueries(%q) returned error: %v", test.sql, err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("GetPlPgSqlQueries(%q) returned %+v; expected %+v", test.sql, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestPlPgSqlQueryParse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		query    pgquery.PlPgSqlQuery
+		expected string
+	}{
+		{
+			"statements",
+			pgquery.PlPgSqlQuery{Query: "UPDATE users SET c = 1"},
+			"UPDATE users SET c = 1",
+		},
+		{
+			"expressions",
+			pgquery.PlPgSqlQuery{Query: "(SELECT count(*) FROM users) > 0", Expression: true},
+			"SELECT (SELECT count(*) FROM users) > 0",
+		},
+		{
+			"assignments",
+			pgquery.PlPgSqlQuery{Query: "a[1] := (SELECT count(*) FROM users)", Expression: true, Assignment: true},
+			"SELECT (SELECT count(*) FROM users)",
+		},
+		{
+			"assignments with =",
+			pgquery.PlPgSqlQuery{Query: "r.f = 1", Expression: true, Assignment: true},
+			"SELECT 1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			parseTree, err := test.query.Parse()
+			if err != nil {
+				t.Fatalf("Parse(%+v) returned error: %v", test.query, err)
+			}
+			got, err := pg_query.Deparse(parseTree)
+			if err != nil {
+				t.Fatalf("Deparse() of %+v returned error: %v", test.query, err)
+			}
+			if got != test.expected {
+				t.Fatalf("Parse(%+v) returned %q; expected %q", test.query, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetFunctionBody(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		sql      string
+		expected *pgquery.FunctionBody
+	}{
+		{
+			"dollar quoted plpgsql function",
+			"CREATE FUNCTION f() RETURNS void LANGUAGE plpgsql AS $$ BEGIN END $$",
+			&pgquery.FunctionBody{
+				Language: "plpgsql",
+				Body:     " BEGIN END ",
+				Offset:   55,
+				Function: "CREATE FUNCTION f() RETURNS void LANGUAGE plpgsql AS $$ BEGIN END $$",
+			},
+		},
+		{
+			"single quoted functions are sql by default, and not found as is",
+			"CREATE FUNCTION f() RETURNS text AS 'SELECT ''a'''",
+			&pgquery.FunctionBody{
+				Language: "sql",
+				Body:     "SELECT 'a'",
+				Offset:   -1,
+				Function: "CREATE FUNCTION f() RETURNS text AS 'SELECT ''a'''",
+			},
+		},
+		{
+			"do blocks are wrapped in a function",
+			"DO $x$ BEGIN PERFORM 1; END $x$",
+			&pgquery.FunctionBody{
+				Language: "plpgsql",
+				Body:     " BEGIN PERFORM 1; END ",
+				Offset:   6,
+				Function: "CREATE FUNCTION pg_temp.do_block() RETURNS void LANGUAGE plpgsql AS $do$ BEGIN PERFORM 1; END $do$",
+			},
+		},
+		{
+			"c functions have no body",
+			"CREATE FUNCTION f() RETURNS void LANGUAGE c AS 'obj_file', 'link_symbol'",
+			nil,
+		},
+		{
+			"sql standard bodies are not returned",
+			"CREATE FUNCTION f() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; END",
+			nil,
+		},
+		{
+			"other statements have no body",
+			"SELECT 1",
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			parseTree, err := pg_query.Parse(test.sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", test.sql, err)
+			}
+			got := pgquery.GetFunctionBody(test.sql, parseTree.Stmts[0])
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("GetFunctionBody(%q) returned %+v; expected %+v", test.sql, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetQueryOffset(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		sql      string
+		expected []int
+	}{
+		{
+			"queries found in the migration",
+			`CREATE FUNCTION f() RETURNS void LANGUAGE plpgsql AS $$
+BEGIN
+  UPDATE users SET c = 1;
+  DELETE FROM users;
+END
+$$`,
+			[]int{64, 90},
+		},
+		{
+			"queries of a body not found in the migration",
+			"CREATE FUNCTION f() RETURNS void LANGUAGE plpgsql AS 'BEGIN DELETE FROM users WHERE name = ''a''; END'",
+			[]int{-1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			parseTree, err := pg_query.Parse(test.sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", test.sql, err)
+			}
+			body := pgquery.GetFunctionBody(test.sql, parseTree.Stmts[0])
+			queries, err := pgquery.GetPlPgSqlQueries(body.Function)
+			if err != nil {
+				t.Fatalf("GetPlPgSqlQueries(%q) returned error: %v", body.Function, err)
+			}
+			got := []int{}
+			for _, query := range queries {
+				got = append(got, body.GetQueryOffset(query))
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("GetQueryOffset() of the queries of %q returned %v; expected %v", test.sql, got, test.expected)
+			}
+		})
+	}
+}
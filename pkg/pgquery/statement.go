@@ -0,0 +1,81 @@
+package pgquery
+
+import (
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+var statementKinds = map[string]string{
+	"SelectStmt":          "SELECT",
+	"InsertStmt":          "INSERT",
+	"UpdateStmt":          "UPDATE",
+	"DeleteStmt":          "DELETE",
+	"MergeStmt":           "MERGE",
+	"CreateStmt":          "CREATE TABLE",
+	"CreateTableAsStmt":   "CREATE TABLE AS",
+	"IndexStmt":           "CREATE INDEX",
+	"ViewStmt":            "CREATE VIEW",
+	"CreateFunctionStmt":  "CREATE FUNCTION",
+	"CreateTrigStmt":      "CREATE TRIGGER",
+	"CreateSeqStmt":       "CREATE SEQUENCE",
+	"AlterSeqStmt":        "ALTER SEQUENCE",
+	"CreateSchemaStmt":    "CREATE SCHEMA",
+	"CreateExtensionStmt": "CREATE EXTENSION",
+	"TruncateStmt":        "TRUNCATE",
+	"LockStmt":            "LOCK",
+	"GrantStmt":           "GRANT",
+	"RenameStmt":          "RENAME",
+	"CopyStmt":            "COPY",
+	"VacuumStmt":          "VACUUM",
+	"ReindexStmt":         "REINDEX",
+	"ClusterStmt":         "CLUSTER",
+	"VariableSetStmt":     "SET",
+	"DoStmt":              "DO",
+}
+
+// object types whose enum name is not how they are written in SQL
+var objectTypeNames = map[pg_query.ObjectType]string{
+	pg_query.ObjectType_OBJECT_MATVIEW:         "MATERIALIZED VIEW",
+	pg_query.ObjectType_OBJECT_FDW:             "FOREIGN DATA WRAPPER",
+	pg_query.ObjectType_OBJECT_FOREIGN_SERVER:  "SERVER",
+	pg_query.ObjectType_OBJECT_LARGEOBJECT:     "LARGE OBJECT",
+	pg_query.ObjectType_OBJECT_STATISTIC_EXT:   "STATISTICS",
+	pg_query.ObjectType_OBJECT_OPCLASS:         "OPERATOR CLASS",
+	pg_query.ObjectType_OBJECT_OPFAMILY:        "OPERATOR FAMILY",
+	pg_query.ObjectType_OBJECT_TABCONSTRAINT:   "CONSTRAINT",
+	pg_query.ObjectType_OBJECT_DOMCONSTRAINT:   "CONSTRAINT",
+	pg_query.ObjectType_OBJECT_TSCONFIGURATION: "TEXT SEARCH CONFIGURATION",
+	pg_query.ObjectType_OBJECT_TSDICTIONARY:    "TEXT SEARCH DICTIONARY",
+	pg_query.ObjectType_OBJECT_TSPARSER:        "TEXT SEARCH PARSER",
+	pg_query.ObjectType_OBJECT_TSTEMPLATE:      "TEXT SEARCH TEMPLATE",
+}
+
+// GetObjectTypeName returns an object type as it is written in SQL, eg: `TABLE` or `MATERIALIZED VIEW`
+func GetObjectTypeName(objectType pg_query.ObjectType) string {
+	if name, ok := objectTypeNames[objectType]; ok {
+		return name
+	}
+	return strings.ReplaceAll(strings.TrimPrefix(objectType.String(), "OBJECT_"), "_", " ")
+}
+
+// GetStatementKind returns the kind of a statement as it is written in SQL, eg: `ALTER TABLE` or `DROP INDEX`
+// statements without a more readable kind return their parse tree node name, eg: `CreateEventTrigStmt`
+func GetStatementKind(statement *pg_query.RawStmt) string {
+	switch {
+	case statement.GetStmt().GetAlterTableStmt() != nil:
+		return "ALTER " + GetObjectTypeName(statement.Stmt.GetAlterTableStmt().Objtype)
+	case statement.GetStmt().GetDropStmt() != nil:
+		return "DROP " + GetObjectTypeName(statement.Stmt.GetDropStmt().RemoveType)
+	}
+	message := statement.GetStmt().ProtoReflect()
+	field := message.WhichOneof(message.Descriptor().Oneofs().ByName("node"))
+	if field == nil {
+		return ""
+	}
+	name := string(field.Message().Name())
+	if kind, ok := statementKinds[name]; ok {
+		return kind
+	}
+	return name
+}
@@ -0,0 +1,63 @@
+package pgquery_test
+
+import (
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+func TestGetStatementKind(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		sql      string
+		expected string
+	}{
+		{"dml", "UPDATE users SET a = 1", "UPDATE"},
+		{"alter table", "ALTER TABLE users ADD COLUMN a int", "ALTER TABLE"},
+		{"alter index", "ALTER INDEX users_idx SET (fillfactor = 50)", "ALTER INDEX"},
+		{"drop", "DROP MATERIALIZED VIEW v", "DROP MATERIALIZED VIEW"},
+		{"create index", "CREATE INDEX ON users (a)", "CREATE INDEX"},
+		{"node name fallback", "CREATE EVENT TRIGGER e ON ddl_command_start EXECUTE FUNCTION f()", "CreateEventTrigStmt"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.name)
+			parseTree, err := pg_query.Parse(test.sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", test.sql, err)
+			}
+			if got := pgquery.GetStatementKind(parseTree.Stmts[0]); got != test.expected {
+				t.Fatalf("GetStatementKind(%q) returned %q; expected %q", test.sql, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetObjectTypeName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		objectType pg_query.ObjectType
+		expected   string
+	}{
+		{pg_query.ObjectType_OBJECT_TABLE, "TABLE"},
+		{pg_query.ObjectType_OBJECT_FOREIGN_TABLE, "FOREIGN TABLE"},
+		{pg_query.ObjectType_OBJECT_MATVIEW, "MATERIALIZED VIEW"},
+		{pg_query.ObjectType_OBJECT_FDW, "FOREIGN DATA WRAPPER"},
+		{pg_query.ObjectType_OBJECT_FOREIGN_SERVER, "SERVER"},
+		{pg_query.ObjectType_OBJECT_STATISTIC_EXT, "STATISTICS"},
+		{pg_query.ObjectType_OBJECT_TSDICTIONARY, "TEXT SEARCH DICTIONARY"},
+	}
+	for _, test := range tests {
+		t.Run(test.objectType.String(), func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.objectType.String())
+			if got := pgquery.GetObjectTypeName(test.objectType); got != test.expected {
+				t.Fatalf("GetObjectTypeName(%v) returned %q; expected %q", test.objectType, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package pgquery
+
+import (
+	"fmt"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// GetTypeName returns the lowercase, unqualified name of a type
+// eg: `character varying(20)` (parsed as `pg_catalog.varchar`) returns `varchar`
+func GetTypeName(typeName *pg_query.TypeName) string {
+	return strings.ToLower(GetUnqualifiedName(typeName.GetNames()))
+}
+
+// GetTypeModifiers returns the integer modifiers of a type
+// eg: `numeric(10, 2)` returns [10, 2]
+func GetTypeModifiers(typeName *pg_query.TypeName) []int {
+	modifiers := []int{}
+	for _, node := range typeName.GetTypmods() {
+		if constant := node.GetAConst(); constant != nil && constant.GetIval() != nil {
+			modifiers = append(modifiers, int(constant.GetIval().Ival))
+		}
+	}
+	return modifiers
+}
+
+func IsArrayType(typeName *pg_query.TypeName) bool {
+	return len(typeName.GetArrayBounds()) > 0
+}
+
+// FormatTypeName returns a human readable form of a type
+// eg: `numeric(10,2)` or `int4[]`
+func FormatTypeName(typeName *pg_query.TypeName) string {
+	text := GetTypeName(typeName)
+	if modifiers := GetTypeModifiers(typeName); len(modifiers) > 0 {
+		strs := []string{}
+		for _, modifier := range modifiers {
+			strs = append(strs, fmt.Sprint(modifier))
+		}
+		text += "(" + strings.Join(strs, ",") + ")"
+	}
+	for range typeName.GetArrayBounds() {
+		text += "[]"
+	}
+	return text
+}
+
+// ParseTypeName parses a type as it would be written in a migration, eg: `double precision`,
+// so that it can be compared with the types of parsed statements (where it is `pg_catalog.float8`)
+func ParseTypeName(typeString string) (*pg_query.TypeName, error) {
+	sql := "SELECT NULL::" + typeString
+	parseTree, err := pg_query.Parse(sql)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing type %q: %w", typeString, err)
+	}
+	if len(parseTree.Stmts) != 1 {
+		return nil, fmt.Errorf("error parsing type %q: not a single type", typeString)
+	}
+	targets := parseTree.Stmts[0].Stmt.GetSelectStmt().GetTargetList()
+	if len(targets) != 1 || targets[0].GetResTarget().GetVal().GetTypeCast() == nil {
+		return nil, fmt.Errorf("error parsing type %q: not a single type", typeString)
+	}
+	return targets[0].GetResTarget().GetVal().GetTypeCast().GetTypeName(), nil
+}
@@ -0,0 +1,92 @@
+package pgquery_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aprimetechnology/derisk-sql/pkg/pgquery"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// parses `ALTER TABLE t ALTER COLUMN c TYPE <typeString>` to get at the resulting TypeName
+func parseTypeName(t *testing.T, typeString string) *pg_query.TypeName {
+	sql := "ALTER TABLE t ALTER COLUMN c TYPE " + typeString
+	parseTree, err := pg_query.Parse(sql)
+	if err != nil {
+		t.Fatalf("Parse(%q) returned error: %v", sql, err)
+	}
+	alter := parseTree.Stmts[0].Stmt.GetAlterTableStmt()
+	return alter.Cmds[0].GetAlterTableCmd().GetDef().GetColumnDef().GetTypeName()
+}
+
+func TestTypeNames(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		typeString        string
+		expectedName      string
+		expectedModifiers []int
+		expectedArray     bool
+		expectedFormat    string
+	}{
+		{"text", "text", []int{}, false, "text"},
+		{"character varying(20)", "varchar", []int{20}, false, "varchar(20)"},
+		{"VARCHAR", "varchar", []int{}, false, "varchar"},
+		{"numeric(10, 2)", "numeric", []int{10, 2}, false, "numeric(10,2)"},
+		{"integer[]", "int4", []int{}, true, "int4[]"},
+		{"timestamp(3) with time zone", "timestamptz", []int{3}, false, "timestamptz(3)"},
+		{"public.my_type", "my_type", []int{}, false, "my_type"},
+	}
+	for _, test := range tests {
+		t.Run(test.typeString, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.typeString)
+			typeName := parseTypeName(t, test.typeString)
+			if got := pgquery.GetTypeName(typeName); got != test.expectedName {
+				t.Fatalf("GetTypeName(%q) returned %q; expected %q", test.typeString, got, test.expectedName)
+			}
+			if got := pgquery.GetTypeModifiers(typeName); !reflect.DeepEqual(got, test.expectedModifiers) {
+				t.Fatalf("GetTypeModifiers(%q) returned %v; expected %v", test.typeString, got, test.expectedModifiers)
+			}
+			if got := pgquery.IsArrayType(typeName); got != test.expectedArray {
+				t.Fatalf("IsArrayType(%q) returned %v; expected %v", test.typeString, got, test.expectedArray)
+			}
+			if got := pgquery.FormatTypeName(typeName); got != test.expectedFormat {
+				t.Fatalf("FormatTypeName(%q) returned %q; expected %q", test.typeString, got, test.expectedFormat)
+			}
+		})
+	}
+}
+
+func TestParseTypeName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		typeString    string
+		expectedName  string
+		expectedError bool
+	}{
+		{"integer", "int4", false},
+		{"INT", "int4", false},
+		{"double precision", "float8", false},
+		{"boolean", "bool", false},
+		{"json", "json", false},
+		{"character varying(20)", "varchar", false},
+		{"public.my_type", "my_type", false},
+		{"not a type", "", true},
+		{"int, text", "", true},
+		{"int; DROP TABLE users", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.typeString, func(t *testing.T) {
+			t.Parallel()
+			t.Log(test.typeString)
+			typeName, err := pgquery.ParseTypeName(test.typeString)
+			if (err != nil) != test.expectedError {
+				t.Fatalf("ParseTypeName(%q) returned error %v; expected error %v", test.typeString, err, test.expectedError)
+			}
+			if got := pgquery.GetTypeName(typeName); got != test.expectedName {
+				t.Fatalf("GetTypeName(ParseTypeName(%q)) returned %q; expected %q", test.typeString, got, test.expectedName)
+			}
+		})
+	}
+}
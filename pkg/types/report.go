@@ -5,6 +5,13 @@ const (
 	DiagnosticLevelWarning = "WARNING"
 )
 
+// the actions a Report may request, along with the Report.Config keys they read,
+// defined here so that analyzers need not depend on the clients carrying them out
+const (
+	GithubReviewersKey     = "github_reviewers"
+	RequestReviewersAction = "github:requestReviewers"
+)
+
 type Diagnostic struct {
 	LineNumber   int    `json:"lineNumber"`
 	LinePosition int    `json:"linePosition"`